@@ -6,11 +6,13 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
 	"analytics-service/internal/auth"
 	"analytics-service/internal/analytics"
+	"analytics-service/internal/audit"
 	"analytics-service/internal/config"
 	"analytics-service/internal/handlers"
 	"analytics-service/internal/userdb"
@@ -25,21 +27,139 @@ func main() {
 	}
 
 	cfg := config.New()
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	tokenStore, err := userdb.OpenFileTokenStore(cfg.TokenDBPath, cfg.LogPasPath)
+	if err != nil {
+		log.Fatalf("Failed to open token store: %v", err)
+	}
+	defer tokenStore.Close()
+
+	userStore, err := userdb.OpenUserStore(cfg.UsersPath)
+	if err != nil {
+		log.Fatalf("Failed to load users: %v", err)
+	}
 
-	tokenStore := userdb.NewTokenStore()
-	if err := tokenStore.LoadFromFile("routes/LogPas.txt"); err != nil {
-		log.Printf("Warning: could not load tokens from file: %v", err)
+	apiKeyStore, err := userdb.OpenAPIKeyStore(cfg.APIKeysPath)
+	if err != nil {
+		log.Fatalf("Failed to load API keys: %v", err)
 	}
 
+	auditLog, err := audit.OpenLog(cfg.AuditLogPath, int64(cfg.AuditLogMaxSizeMB)<<20, cfg.AuditLogMaxFiles)
+	if err != nil {
+		log.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer auditLog.Close()
+
 	authService := auth.NewService(cfg.SecretKey, tokenStore)
+	authService.SetUserStore(userStore)
 
-	analyticsService := analytics.NewService()
+	if cfg.SigningKeysPath != "" {
+		keyRing, err := auth.LoadKeyRing(cfg.SigningKeysPath)
+		if err != nil {
+			log.Fatalf("Failed to load signing keys: %v", err)
+		}
+		// Tokens signed with AUTH_SECRET_KEY before the key ring was set up
+		// carry no kid; keep verifying them until they expire.
+		if cfg.SecretKey != config.DefaultSecretKey {
+			keyRing.AddVerifyKey("", cfg.SecretKey)
+		}
+		authService.SetKeyRing(keyRing)
+	}
+
+	authService.SetAPIKeyStore(apiKeyStore)
+	authService.SetLegacyTokens(cfg.LegacyTokens)
+	authService.SetAdmins(cfg.AdminUserIDs)
+	authService.SetIssuer(cfg.TokenIssuer)
+	authService.SetTokenTTL(time.Duration(cfg.TokenTTLSec) * time.Second)
+	authService.SetRefreshTTL(time.Duration(cfg.RefreshTTLSec) * time.Second)
+	authService.SetClockSkew(time.Duration(cfg.ClockSkewSec) * time.Second)
+
+	dataSource := analytics.NewFileDataSource(cfg.StockDumpPath, cfg.SalesDumpPath)
+	analyticsService := analytics.NewService(dataSource)
 	analyticsService.SetWorkers(cfg.Workers)
 
+	cacheCtx, stopCache := context.WithCancel(context.Background())
+	defer stopCache()
+
+	// While legacy tokens are accepted, LogPas.txt stays their source of
+	// truth: edits, removals included, apply at startup, whenever the file
+	// changes and on SIGHUP.
+	if cfg.LegacyTokens {
+		reloadLegacy := func(reason string) {
+			changes, err := tokenStore.ReloadLegacy(cfg.LogPasPath)
+			if err != nil {
+				log.Printf("Warning: not reloading %s on %s: %v", cfg.LogPasPath, reason, err)
+				return
+			}
+			log.Printf("Reloaded %s on %s: %s", cfg.LogPasPath, reason, changes.String())
+		}
+		reloadLegacy("startup")
+
+		go tokenStore.WatchLegacy(cacheCtx, cfg.LogPasPath, time.Duration(cfg.LogPasReloadSec)*time.Second)
+
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				reloadLegacy("SIGHUP")
+			}
+		}()
+	}
+
+	// Without the cache every request streams only its window from the
+	// dumps, which keeps memory flat when the dumps do not fit into it.
+	reloadInterval := time.Duration(cfg.DataReloadSec) * time.Second
+	if cfg.DataCache {
+		if err := analyticsService.EnableCache(cacheCtx, reloadInterval); err != nil {
+			log.Printf("Warning: could not preload dataset, reading dumps per request: %v", err)
+		}
+	}
+
+	loginLimiter := auth.NewLoginLimiter()
+	loginLimiter.SetLimits(cfg.LoginFailures, cfg.LoginIPFailures)
+	loginLimiter.SetLockout(time.Duration(cfg.LoginLockoutSec)*time.Second, time.Duration(cfg.LoginMaxLockoutSec)*time.Second)
+
 	authHandler := handlers.NewAuthHandler(authService)
+	authHandler.SetLoginLimiter(loginLimiter)
+	authHandler.SetAuditLog(auditLog)
 	userHandler := handlers.NewUserHandler(authService)
+	userHandler.SetAuditLog(auditLog)
+	apiKeyHandler := handlers.NewAPIKeyHandler(authService)
+	apiKeyHandler.SetAuditLog(auditLog)
+	auditHandler := handlers.NewAuditHandler(auditLog)
 	analyticsHandler := handlers.NewAnalyticsHandler(analyticsService, authService)
 
+	if cfg.TenantsDir != "" {
+		tenants, err := os.ReadDir(cfg.TenantsDir)
+		if err != nil {
+			log.Fatalf("Failed to read tenants directory: %v", err)
+		}
+
+		for _, entry := range tenants {
+			if !entry.IsDir() {
+				continue
+			}
+
+			dir := filepath.Join(cfg.TenantsDir, entry.Name())
+			tenantService := analytics.NewService(analytics.NewFileDataSource(
+				filepath.Join(dir, "stock_dump.json"),
+				filepath.Join(dir, "sales_dump.json"),
+			))
+			tenantService.SetWorkers(cfg.Workers)
+			if cfg.DataCache {
+				if err := tenantService.EnableCache(cacheCtx, reloadInterval); err != nil {
+					log.Printf("Warning: could not preload dataset of tenant %s: %v", entry.Name(), err)
+				}
+			}
+
+			analyticsHandler.SetTenantService(entry.Name(), tenantService)
+			log.Printf("Serving tenant %s from %s", entry.Name(), dir)
+		}
+	}
+
 	router := mux.NewRouter()
 	
 	router.Use(func(next http.Handler) http.Handler {
@@ -58,8 +178,39 @@ func main() {
 	})
 
 	router.HandleFunc("/auth", authHandler.GenerateToken).Methods("POST")
-	router.HandleFunc("/validate", userHandler.ValidateToken).Methods("GET")
-	router.HandleFunc("/analytics", analyticsHandler.GetItemAnalytics).Methods("POST")
+	router.HandleFunc("/auth/refresh", authHandler.RefreshToken).Methods("POST")
+	router.HandleFunc("/.well-known/jwks.json", authHandler.PublicKeys).Methods("GET")
+	router.HandleFunc("/register", authHandler.Register).Methods("POST")
+	router.HandleFunc("/account/password", authHandler.ChangePassword).Methods("POST")
+	router.HandleFunc("/account/disable", authHandler.DisableAccount).Methods("POST")
+
+	authMiddleware := handlers.NewAuthMiddleware(authService)
+	authMiddleware.SetTokenParams(cfg.TokenParams)
+	authMiddleware.SetAuditLog(auditLog)
+
+	tokenRoutes := router.NewRoute().Subrouter()
+	tokenRoutes.Use(authMiddleware.Authenticate)
+	tokenRoutes.HandleFunc("/validate", userHandler.ValidateToken).Methods("GET")
+	tokenRoutes.HandleFunc("/logout", userHandler.Logout).Methods("POST")
+
+	readRoutes := router.NewRoute().Subrouter()
+	readRoutes.Use(authMiddleware.Require(auth.PermReadAnalytics), auditHandler.Track)
+	readRoutes.HandleFunc("/analytics", analyticsHandler.GetItemAnalytics).Methods("POST")
+
+	exploreRoutes := router.NewRoute().Subrouter()
+	exploreRoutes.Use(authMiddleware.Require(auth.PermExploreAnalytics), auditHandler.Track)
+	exploreRoutes.HandleFunc("/analytics/timeseries", analyticsHandler.GetTimeSeries).Methods("POST")
+	exploreRoutes.HandleFunc("/analytics/groups", analyticsHandler.GetGroupAnalytics).Methods("POST")
+
+	adminRoutes := router.PathPrefix("/admin").Subrouter()
+	adminRoutes.Use(authMiddleware.Require(auth.PermAdmin))
+	adminRoutes.HandleFunc("/tokens/revoke", userHandler.RevokeUserTokens).Methods("POST")
+	adminRoutes.HandleFunc("/reload", analyticsHandler.Reload).Methods("POST")
+	adminRoutes.HandleFunc("/data/{kind}", analyticsHandler.UploadData).Methods("PUT")
+	adminRoutes.HandleFunc("/api-keys", apiKeyHandler.CreateAPIKey).Methods("POST")
+	adminRoutes.HandleFunc("/api-keys", apiKeyHandler.ListAPIKeys).Methods("GET")
+	adminRoutes.HandleFunc("/api-keys/{id}", apiKeyHandler.RevokeAPIKey).Methods("DELETE")
+	adminRoutes.HandleFunc("/audit", auditHandler.Query).Methods("GET")
 	
 	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
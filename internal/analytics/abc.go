@@ -0,0 +1,127 @@
+package analytics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const maxABCClasses = 5
+
+var abcLabels = []string{"A", "B", "C", "D", "E"}
+
+var abcMetrics = map[string]func(*ItemAnalyticsResult) float64{
+	"sales":    func(item *ItemAnalyticsResult) float64 { return item.Sales },
+	"quantity": func(item *ItemAnalyticsResult) float64 { return item.Quantity },
+	"loss":     func(item *ItemAnalyticsResult) float64 { return item.Loss },
+}
+
+type abcConfig struct {
+	metric     func(*ItemAnalyticsResult) float64
+	thresholds []float64
+}
+
+func defaultABCConfig() abcConfig {
+	return abcConfig{
+		metric:     abcMetrics["sales"],
+		thresholds: []float64{80, 95},
+	}
+}
+
+func resolveABCOptions(opts *ABCOptions) (abcConfig, error) {
+	cfg := defaultABCConfig()
+	if opts == nil {
+		return cfg, nil
+	}
+
+	if opts.Metric != "" {
+		metric, ok := abcMetrics[strings.ToLower(opts.Metric)]
+		if !ok {
+			if strings.EqualFold(opts.Metric, "margin") {
+				return cfg, &ValidationError{Message: "ABC.Metric margin is not available: the dumps carry no cost prices"}
+			}
+			return cfg, &ValidationError{Message: fmt.Sprintf("ABC.Metric must be one of sales, quantity, loss, got %q", opts.Metric)}
+		}
+		cfg.metric = metric
+	}
+
+	classes := opts.Classes
+	if classes == 0 {
+		if len(opts.Thresholds) == 0 {
+			return cfg, nil
+		}
+		classes = len(opts.Thresholds) + 1
+	}
+
+	if classes < 2 || classes > maxABCClasses {
+		return cfg, &ValidationError{Message: fmt.Sprintf("ABC.Classes must be between 2 and %d, got %d", maxABCClasses, classes)}
+	}
+
+	thresholds := opts.Thresholds
+	if len(thresholds) == 0 {
+		if classes != len(cfg.thresholds)+1 {
+			return cfg, &ValidationError{Message: fmt.Sprintf("ABC.Thresholds are required for %d classes", classes)}
+		}
+		return cfg, nil
+	}
+
+	if len(thresholds) != classes-1 {
+		return cfg, &ValidationError{Message: fmt.Sprintf("ABC.Thresholds must have %d values for %d classes, got %d", classes-1, classes, len(thresholds))}
+	}
+
+	prev := 0.0
+	for i, threshold := range thresholds {
+		if threshold <= prev || threshold >= 100 {
+			return cfg, &ValidationError{Message: fmt.Sprintf("ABC.Thresholds must be strictly increasing percentages between 0 and 100, got %g at position %d", threshold, i)}
+		}
+		prev = threshold
+	}
+
+	cfg.thresholds = thresholds
+	return cfg, nil
+}
+
+// classifyABC ranks items by the configured metric, highest first with ties
+// broken by code, and labels each by its cumulative share. The order of items
+// itself is left untouched, so the result does not depend on it.
+func (s *Service) classifyABC(items []ItemAnalyticsResult, cfg abcConfig) {
+	if len(items) == 0 {
+		return
+	}
+
+	total := 0.0
+	for i := range items {
+		total += cfg.metric(&items[i])
+	}
+
+	if total <= 0 {
+		return
+	}
+
+	order := make([]int, len(items))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool {
+		va, vb := cfg.metric(&items[order[a]]), cfg.metric(&items[order[b]])
+		if va != vb {
+			return va > vb
+		}
+		return items[order[a]].Code < items[order[b]].Code
+	})
+
+	cumulative := 0.0
+	for _, i := range order {
+		cumulative += cfg.metric(&items[i])
+		share := (cumulative / total) * 100
+
+		class := len(cfg.thresholds)
+		for j, threshold := range cfg.thresholds {
+			if share <= threshold {
+				class = j
+				break
+			}
+		}
+		items[i].ABC = abcLabels[class]
+	}
+}
@@ -0,0 +1,91 @@
+package analytics
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestResolveABCOptions(t *testing.T) {
+	cfg, err := resolveABCOptions(nil)
+	if err != nil || len(cfg.thresholds) != 2 || cfg.thresholds[0] != 80 || cfg.thresholds[1] != 95 {
+		t.Fatalf("Unexpected defaults: %+v %v", cfg.thresholds, err)
+	}
+
+	cfg, err = resolveABCOptions(&ABCOptions{Thresholds: []float64{70, 90}})
+	if err != nil || cfg.thresholds[0] != 70 || cfg.thresholds[1] != 90 {
+		t.Fatalf("Expected 70/90 thresholds, got %+v %v", cfg.thresholds, err)
+	}
+
+	cfg, err = resolveABCOptions(&ABCOptions{Metric: "Quantity", Classes: 4, Thresholds: []float64{50, 75, 90}})
+	if err != nil || len(cfg.thresholds) != 3 {
+		t.Fatalf("Expected 4 classes by quantity, got %+v %v", cfg.thresholds, err)
+	}
+
+	if value := cfg.metric(&ItemAnalyticsResult{Sales: 1, Quantity: 7}); value != 7 {
+		t.Fatalf("Expected quantity metric, got %f", value)
+	}
+
+	invalid := []ABCOptions{
+		{Metric: "margin"},
+		{Metric: "profit"},
+		{Thresholds: []float64{90, 70}},
+		{Thresholds: []float64{80, 100}},
+		{Thresholds: []float64{0, 50}},
+		{Classes: 3, Thresholds: []float64{80}},
+		{Classes: 4},
+		{Classes: 1},
+		{Classes: 6, Thresholds: []float64{10, 20, 30, 40, 50}},
+	}
+	for _, opts := range invalid {
+		var validationErr *ValidationError
+		if _, err := resolveABCOptions(&opts); !errors.As(err, &validationErr) {
+			t.Fatalf("Expected validation error for %+v, got %v", opts, err)
+		}
+	}
+}
+
+func TestService_classifyABC_CustomConfig(t *testing.T) {
+	service := NewService(&MemoryDataSource{})
+
+	cfg, err := resolveABCOptions(&ABCOptions{Metric: "quantity", Thresholds: []float64{50, 75, 90}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	items := []ItemAnalyticsResult{
+		{Code: "1", Sales: 1, Quantity: 50},
+		{Code: "2", Sales: 1000, Quantity: 25},
+		{Code: "3", Sales: 1, Quantity: 15},
+		{Code: "4", Sales: 1, Quantity: 10},
+	}
+
+	service.classifyABC(items, cfg)
+
+	expected := []string{"A", "B", "C", "D"}
+	for i, item := range items {
+		if item.ABC != expected[i] {
+			t.Fatalf("Item %s: expected %s, got %s", item.Code, expected[i], item.ABC)
+		}
+	}
+}
+
+func TestService_calculateABCClassification_IgnoresInputOrder(t *testing.T) {
+	service := NewService(&MemoryDataSource{})
+
+	items := []ItemAnalyticsResult{
+		{Code: "4", Sales: 100},
+		{Code: "3", Sales: 200},
+		{Code: "2b", Sales: 350},
+		{Code: "2a", Sales: 350},
+		{Code: "1", Sales: 1000},
+	}
+
+	service.calculateABCClassification(items)
+
+	expected := map[string]string{"1": "A", "2a": "A", "2b": "B", "3": "B", "4": "C"}
+	for _, item := range items {
+		if item.ABC != expected[item.Code] {
+			t.Fatalf("Item %s: expected %s, got %s", item.Code, expected[item.Code], item.ABC)
+		}
+	}
+}
@@ -1,12 +1,16 @@
 package analytics
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
 
 func BenchmarkService_calculateOSA(b *testing.B) {
-	service := NewService()
+	service := NewService(&MemoryDataSource{})
 	
 	startDate := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
 	endDate := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
@@ -28,7 +32,7 @@ func BenchmarkService_calculateOSA(b *testing.B) {
 }
 
 func BenchmarkService_calculateABCClassification(b *testing.B) {
-	service := NewService()
+	service := NewService(&MemoryDataSource{})
 	
 
 	items := make([]ItemAnalyticsResult, 10000)
@@ -48,7 +52,7 @@ func BenchmarkService_calculateABCClassification(b *testing.B) {
 }
 
 func BenchmarkService_parseDateTime(b *testing.B) {
-	service := NewService()
+	service := NewService(&MemoryDataSource{})
 	dateStr := "02.01.2024 15:04:05"
 	
 	b.ResetTimer()
@@ -58,7 +62,7 @@ func BenchmarkService_parseDateTime(b *testing.B) {
 }
 
 func BenchmarkService_splitIntoChunks(b *testing.B) {
-	service := NewService()
+	service := NewService(&MemoryDataSource{})
 	service.SetWorkers(8)
 	
 
@@ -76,7 +80,7 @@ func BenchmarkService_splitIntoChunks(b *testing.B) {
 }
 
 func BenchmarkService_processChunk(b *testing.B) {
-	service := NewService()
+	service := NewService(&MemoryDataSource{})
 	
 	startDate := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
 	endDate := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
@@ -104,7 +108,7 @@ func BenchmarkService_processChunk(b *testing.B) {
 }
 
 func BenchmarkService_processDataParallel(b *testing.B) {
-	service := NewService()
+	service := NewService(&MemoryDataSource{})
 	service.SetWorkers(8)
 	
 	startDate := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
@@ -139,25 +143,25 @@ func BenchmarkService_processDataParallel(b *testing.B) {
 
 
 func BenchmarkService_processDataParallel_2Workers(b *testing.B) {
-	service := NewService()
+	service := NewService(&MemoryDataSource{})
 	service.SetWorkers(2)
 	benchmarkProcessDataParallel(service, b)
 }
 
 func BenchmarkService_processDataParallel_4Workers(b *testing.B) {
-	service := NewService()
+	service := NewService(&MemoryDataSource{})
 	service.SetWorkers(4)
 	benchmarkProcessDataParallel(service, b)
 }
 
 func BenchmarkService_processDataParallel_8Workers(b *testing.B) {
-	service := NewService()
+	service := NewService(&MemoryDataSource{})
 	service.SetWorkers(8)
 	benchmarkProcessDataParallel(service, b)
 }
 
 func BenchmarkService_processDataParallel_16Workers(b *testing.B) {
-	service := NewService()
+	service := NewService(&MemoryDataSource{})
 	service.SetWorkers(16)
 	benchmarkProcessDataParallel(service, b)
 }
@@ -192,3 +196,30 @@ func benchmarkProcessDataParallel(service *Service, b *testing.B) {
 		service.processDataParallel(stockData, salesData, startDate, endDate)
 	}
 }
+
+func BenchmarkFileDataSource_LoadStock(b *testing.B) {
+	var sb strings.Builder
+	sb.WriteString("[")
+	for i := 0; i < 10000; i++ {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		fmt.Fprintf(&sb, `{"НоменклатураКод": "%d", "Период": "%02d.01.2024 12:00:00", "НачальныйОстаток": %d, "КонечныйОстаток": %d}`,
+			i%1000, i%28+1, i%100, (i+1)%100)
+	}
+	sb.WriteString("]")
+	
+	path := filepath.Join(b.TempDir(), "stock.json")
+	if err := os.WriteFile(path, []byte(sb.String()), 0644); err != nil {
+		b.Fatalf("Failed to write stock dump: %v", err)
+	}
+	
+	source := NewFileDataSource(path, "")
+	startDate := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	endDate := time.Date(2024, 1, 20, 0, 0, 0, 0, time.UTC)
+	
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		source.LoadStock(startDate, endDate)
+	}
+}
@@ -0,0 +1,117 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"time"
+)
+
+type dataset struct {
+	stock   []StockItem
+	sales   []SalesItem
+	version string
+}
+
+// EnableCache loads the full dataset into memory and keeps it fresh by
+// polling the source version every interval until ctx is cancelled.
+func (s *Service) EnableCache(ctx context.Context, interval time.Duration) error {
+	if _, err := s.reloadDataset(); err != nil {
+		return err
+	}
+
+	go s.watchDataset(ctx, interval)
+	return nil
+}
+
+func (s *Service) watchDataset(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.reloadDataset(); err != nil {
+				log.Printf("Warning: could not reload dataset: %v", err)
+			}
+		}
+	}
+}
+
+// Reload forces the cached dataset to be re-read from the source. Without a
+// cache every request reads the source anyway, so there is nothing to do.
+func (s *Service) Reload() error {
+	if s.dataset.Load() == nil {
+		return nil
+	}
+
+	_, err := s.loadDataset(true)
+	return err
+}
+
+// reloadDataset re-reads the source when its version differs from the cached
+// one. Sources that do not report a version are loaded only once.
+func (s *Service) reloadDataset() (bool, error) {
+	return s.loadDataset(false)
+}
+
+func (s *Service) loadDataset(force bool) (bool, error) {
+	version := ""
+	if vs, ok := s.source.(VersionedSource); ok {
+		v, err := vs.Version()
+		if err != nil {
+			return false, err
+		}
+		version = v
+	}
+
+	if current := s.dataset.Load(); !force && current != nil && current.version == version {
+		return false, nil
+	}
+
+	stock, err := s.source.LoadStock(time.Time{}, time.Time{})
+	if err != nil {
+		return false, err
+	}
+
+	sales, err := s.source.LoadSales(time.Time{}, time.Time{})
+	if err != nil {
+		return false, err
+	}
+
+	s.dataset.Store(&dataset{
+		stock:   stock,
+		sales:   sales,
+		version: version,
+	})
+
+	log.Printf("Dataset loaded: %d stock items and %d sales items", len(stock), len(sales))
+	return true, nil
+}
+
+// ReplaceData swaps the stock or sales dump of a writable source and reloads
+// the cache so the next request sees the new rows.
+func (s *Service) ReplaceData(kind string, r io.Reader) error {
+	ws, ok := s.source.(WritableSource)
+	if !ok {
+		return &ValidationError{Message: "this data source does not accept uploads"}
+	}
+
+	var err error
+	switch kind {
+	case "stock":
+		err = ws.ReplaceStock(r)
+	case "sales":
+		err = ws.ReplaceSales(r)
+	default:
+		return &ValidationError{Message: fmt.Sprintf("unknown dump %q, expected stock or sales", kind)}
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.Reload()
+}
@@ -0,0 +1,219 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestService_reloadDataset_DetectsChanges(t *testing.T) {
+	source := createTestDataFiles(t)
+	service := NewService(source)
+
+	changed, err := service.reloadDataset()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !changed {
+		t.Fatal("Expected initial load to populate the cache")
+	}
+
+	first := service.dataset.Load()
+	if len(first.stock) != 1 || len(first.sales) != 1 {
+		t.Fatalf("Expected 1 stock and 1 sales item, got %d and %d", len(first.stock), len(first.sales))
+	}
+
+	changed, err = service.reloadDataset()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if changed {
+		t.Fatal("Expected unchanged files not to trigger a reload")
+	}
+
+	salesData := `[
+		{"Код": "1001", "Номенклатура": "Товар 1", "Количество": 5, "Сумма": 500},
+		{"Код": "1002", "Номенклатура": "Товар 2", "Количество": 1, "Сумма": 100}
+	]`
+	if err := os.WriteFile(source.salesPath, []byte(salesData), 0644); err != nil {
+		t.Fatalf("Failed to rewrite sales file: %v", err)
+	}
+
+	changed, err = service.reloadDataset()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !changed {
+		t.Fatal("Expected modified sales file to trigger a reload")
+	}
+
+	if len(first.sales) != 1 {
+		t.Fatal("Expected previous snapshot to stay untouched")
+	}
+
+	if current := service.dataset.Load(); len(current.sales) != 2 {
+		t.Fatalf("Expected 2 sales items after reload, got %d", len(current.sales))
+	}
+}
+
+func TestService_EnableCache_ServesFromMemory(t *testing.T) {
+	source := createTestDataFiles(t)
+	service := NewService(source)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := service.EnableCache(ctx, time.Hour); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	os.Remove(source.stockPath)
+	os.Remove(source.salesPath)
+
+	req := &ItemAnalyticsRequest{
+		StartDate:  "01.01.2024",
+		FinishDate: "31.01.2024",
+	}
+
+	response, err := service.GetItemAnalytics(req)
+	if err != nil {
+		t.Fatalf("Expected cached data to be used, got %v", err)
+	}
+
+	if response.Total != 1 {
+		t.Fatalf("Expected 1 item, got %d", response.Total)
+	}
+}
+
+func TestService_EnableCache_SameOSAAsWindowedLoad(t *testing.T) {
+	stockPath := writeDump(t, "stock.json", `[
+		{"НоменклатураКод": "1001", "Номенклатура": "Товар 1", "Период": "20.12.2023 10:00:00", "НачальныйОстаток": 0, "КонечныйОстаток": 0},
+		{"НоменклатураКод": "1001", "Номенклатура": "Товар 1", "Период": "01.01.2024 10:00:00", "НачальныйОстаток": 0, "КонечныйОстаток": 10},
+		{"НоменклатураКод": "1002", "Номенклатура": "Товар 2", "Период": "01.01.2024 10:00:00", "НачальныйОстаток": 5, "КонечныйОстаток": 0},
+		{"НоменклатураКод": "1002", "Номенклатура": "Товар 2", "Период": "15.02.2024 00:00:00", "НачальныйОстаток": 0, "КонечныйОстаток": 4}
+	]`)
+	salesPath := writeDump(t, "sales.json", `[
+		{"Код": "1001", "Номенклатура": "Товар 1", "Период": "10.02.2024 12:00:00", "Количество": 1, "Сумма": 100},
+		{"Код": "1002", "Номенклатура": "Товар 2", "Период": "20.02.2024 12:00:00", "Количество": 1, "Сумма": 50}
+	]`)
+
+	req := &ItemAnalyticsRequest{
+		StartDate:  "01.02.2024",
+		FinishDate: "29.02.2024",
+	}
+
+	uncached, err := NewService(NewFileDataSource(stockPath, salesPath)).GetItemAnalytics(req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	service := NewService(NewFileDataSource(stockPath, salesPath))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := service.EnableCache(ctx, time.Hour); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	cached, err := service.GetItemAnalytics(req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	osa := make(map[string]float64)
+	for _, item := range cached.Items {
+		osa[item.Code] = item.OSA
+	}
+	for _, item := range uncached.Items {
+		if osa[item.Code] != item.OSA {
+			t.Fatalf("Expected OSA of %s to match the cache, got %v and %v", item.Code, item.OSA, osa[item.Code])
+		}
+	}
+
+	if osa["1001"] != 100 {
+		t.Fatalf("Expected balance from January to carry into February, got OSA %v", osa["1001"])
+	}
+	if osa["1002"] <= 0 || osa["1002"] >= 100 {
+		t.Fatalf("Expected item 1002 out of stock until 15.02, got OSA %v", osa["1002"])
+	}
+}
+
+func TestService_EnableCache_LossWithinWindow(t *testing.T) {
+	stockPath := writeDump(t, "stock.json", `[
+		{"НоменклатураКод": "1001", "Номенклатура": "Товар 1", "Период": "20.12.2023 10:00:00", "НачальныйОстаток": 10, "КонечныйОстаток": 7, "СтатьяРасходов": "Порча на складах (94)"},
+		{"НоменклатураКод": "1001", "Номенклатура": "Товар 1", "Период": "10.01.2024 10:00:00", "НачальныйОстаток": 7, "КонечныйОстаток": 5, "СтатьяРасходов": "Порча на складах (94)"},
+		{"НоменклатураКод": "1001", "Номенклатура": "Товар 1", "Период": "05.02.2024 10:00:00", "НачальныйОстаток": 5, "КонечныйОстаток": 4, "СтатьяРасходов": "Порча на складах (94)"}
+	]`)
+	salesPath := writeDump(t, "sales.json", `[
+		{"Код": "1001", "Номенклатура": "Товар 1", "Период": "15.01.2024 12:00:00", "Количество": 1, "Сумма": 100}
+	]`)
+
+	service := NewService(NewFileDataSource(stockPath, salesPath))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := service.EnableCache(ctx, time.Hour); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	response, err := service.GetItemAnalytics(&ItemAnalyticsRequest{
+		StartDate:  "01.01.2024",
+		FinishDate: "31.01.2024",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if response.Total != 1 || response.Items[0].Loss != 200 {
+		t.Fatalf("Expected only January spoilage to count from the full cached dump, got %+v", response.Items)
+	}
+}
+
+func TestService_EnableCache_MissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	service := NewService(NewFileDataSource(filepath.Join(dir, "stock.json"), filepath.Join(dir, "sales.json")))
+
+	if err := service.EnableCache(context.Background(), time.Hour); err == nil {
+		t.Fatal("Expected error for missing dump files")
+	}
+}
+
+func TestService_ReplaceData(t *testing.T) {
+	source := createTestDataFiles(t)
+	service := NewService(source)
+
+	if err := service.EnableCache(context.Background(), time.Hour); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	salesData := `[
+		{"Код": "1001", "Номенклатура": "Товар 1", "Количество": 5, "Сумма": 500},
+		{"Код": "1002", "Номенклатура": "Товар 2", "Количество": 1, "Сумма": 100}
+	]`
+	if err := service.ReplaceData("sales", strings.NewReader(salesData)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if current := service.dataset.Load(); len(current.sales) != 2 {
+		t.Fatalf("Expected 2 sales items after upload, got %d", len(current.sales))
+	}
+
+	var validationErr *ValidationError
+	for kind, content := range map[string]string{"sales": `[{"Код": "1001"`, "returns": `[]`} {
+		if err := service.ReplaceData(kind, strings.NewReader(content)); !errors.As(err, &validationErr) {
+			t.Fatalf("Expected ValidationError for %s upload, got %v", kind, err)
+		}
+	}
+
+	if current := service.dataset.Load(); len(current.sales) != 2 {
+		t.Fatalf("Expected rejected upload to keep the dump, got %d sales items", len(current.sales))
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(source.salesPath))
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".upload-") {
+			t.Fatalf("Expected rejected upload to be cleaned up, found %s", entry.Name())
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package analytics
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DataSource provides stock and sales rows for a date range. A zero
+// startDate or finishDate leaves that side of the range open.
+type DataSource interface {
+	LoadStock(startDate, finishDate time.Time) ([]StockItem, error)
+	LoadSales(startDate, finishDate time.Time) ([]SalesItem, error)
+}
+
+// VersionedSource is implemented by sources that can cheaply report whether
+// their contents changed since the last load.
+type VersionedSource interface {
+	DataSource
+	Version() (string, error)
+}
+
+// WritableSource is implemented by sources whose dumps can be replaced through
+// the admin API.
+type WritableSource interface {
+	ReplaceStock(r io.Reader) error
+	ReplaceSales(r io.Reader) error
+}
+
+type FileDataSource struct {
+	stockPath string
+	salesPath string
+}
+
+func NewFileDataSource(stockPath, salesPath string) *FileDataSource {
+	return &FileDataSource{
+		stockPath: stockPath,
+		salesPath: salesPath,
+	}
+}
+
+// LoadStock streams the stock dump and keeps rows whose Период falls into
+// [startDate, finishDate). OSA needs the balance each item entered the window
+// with, so the latest row before startDate is kept for every code as well;
+// the result is what the full dump would give for that window.
+func (ds *FileDataSource) LoadStock(startDate, finishDate time.Time) ([]StockItem, error) {
+	var codes []string
+	carried := make(map[string]StockItem)
+	carriedAt := make(map[string]time.Time)
+
+	items, err := decodeJSONArray(ds.stockPath, func(item *StockItem) bool {
+		if startDate.IsZero() {
+			return inPeriod(item.Период, startDate, finishDate)
+		}
+
+		dt := parsePeriod(item.Период)
+		if dt == nil || !dt.Before(startDate) {
+			return inPeriod(item.Период, startDate, finishDate)
+		}
+
+		code := strings.TrimSpace(item.НоменклатураКод)
+		last, seen := carriedAt[code]
+		if !seen {
+			codes = append(codes, code)
+		}
+		if !seen || !dt.Before(last) {
+			carried[code] = *item
+			carriedAt[code] = *dt
+		}
+		return false
+	})
+	if err != nil || len(codes) == 0 {
+		return items, err
+	}
+
+	stock := make([]StockItem, 0, len(codes)+len(items))
+	for _, code := range codes {
+		stock = append(stock, carried[code])
+	}
+	return append(stock, items...), nil
+}
+
+// LoadSales streams the sales dump and keeps rows whose Период falls into
+// [startDate, finishDate). Rows in the legacy undated format are always kept.
+func (ds *FileDataSource) LoadSales(startDate, finishDate time.Time) ([]SalesItem, error) {
+	return decodeJSONArray(ds.salesPath, func(item *SalesItem) bool {
+		return item.Период == "" || inPeriod(item.Период, startDate, finishDate)
+	})
+}
+
+func (ds *FileDataSource) Version() (string, error) {
+	stockInfo, err := os.Stat(ds.stockPath)
+	if err != nil {
+		return "", err
+	}
+
+	salesInfo, err := os.Stat(ds.salesPath)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%d:%d:%d:%d",
+		stockInfo.ModTime().UnixNano(), stockInfo.Size(),
+		salesInfo.ModTime().UnixNano(), salesInfo.Size()), nil
+}
+
+func (ds *FileDataSource) ReplaceStock(r io.Reader) error {
+	return replaceDump[StockItem](ds.stockPath, r)
+}
+
+func (ds *FileDataSource) ReplaceSales(r io.Reader) error {
+	return replaceDump[SalesItem](ds.salesPath, r)
+}
+
+// replaceDump spools r next to path, checks that it decodes as an array of T
+// and only then renames it over the old dump, so readers never see a partial
+// or malformed file.
+func replaceDump[T any](path string, r io.Reader) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to store upload: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to store upload: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to store upload: %w", err)
+	}
+
+	if _, err := decodeJSONArray(tmp.Name(), func(*T) bool { return false }); err != nil {
+		message := strings.TrimPrefix(err.Error(), tmp.Name()+": ")
+		return &ValidationError{Message: fmt.Sprintf("invalid dump: %s", message)}
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
+
+// decodeJSONArray reads a top-level JSON array one element at a time so that
+// rows rejected by keep are never held in memory.
+func decodeJSONArray[T any](path string, keep func(*T) bool) ([]T, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	dec := json.NewDecoder(bufio.NewReaderSize(file, 1<<20))
+
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return nil, fmt.Errorf("%s: expected JSON array", path)
+	}
+
+	var items []T
+	for i := 0; dec.More(); i++ {
+		var item T
+		if err := dec.Decode(&item); err != nil {
+			return nil, fmt.Errorf("%s: element %d: %w", path, i, err)
+		}
+		if keep(&item) {
+			items = append(items, item)
+		}
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return items, nil
+}
+
+func inPeriod(period string, startDate, finishDate time.Time) bool {
+	if startDate.IsZero() && finishDate.IsZero() {
+		return true
+	}
+
+	dt := parsePeriod(period)
+	if dt == nil {
+		return false
+	}
+	if !startDate.IsZero() && dt.Before(startDate) {
+		return false
+	}
+	if !finishDate.IsZero() && !dt.Before(finishDate) {
+		return false
+	}
+	return true
+}
+
+type MemoryDataSource struct {
+	Stock []StockItem
+	Sales []SalesItem
+}
+
+func (ds *MemoryDataSource) LoadStock(startDate, finishDate time.Time) ([]StockItem, error) {
+	return ds.Stock, nil
+}
+
+func (ds *MemoryDataSource) LoadSales(startDate, finishDate time.Time) ([]SalesItem, error) {
+	return ds.Sales, nil
+}
@@ -0,0 +1,117 @@
+package analytics
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeDump(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestFileDataSource_LoadStock_FiltersByPeriod(t *testing.T) {
+	stockPath := writeDump(t, "stock.json", `[
+		{"НоменклатураКод": "1001", "Период": "31.12.2023 23:59:59", "НачальныйОстаток": 5, "КонечныйОстаток": 4},
+		{"НоменклатураКод": "1001", "Период": "01.01.2024 00:00:00", "НачальныйОстаток": 4, "КонечныйОстаток": 3},
+		{"НоменклатураКод": "1002", "Период": "15.01.2024 10:30", "НачальныйОстаток": 3, "КонечныйОстаток": 2},
+		{"НоменклатураКод": "1003", "Период": "01.02.2024", "НачальныйОстаток": 2, "КонечныйОстаток": 1},
+		{"НоменклатураКод": "1004", "Период": "not a date", "НачальныйОстаток": 1, "КонечныйОстаток": 0}
+	]`)
+	source := NewFileDataSource(stockPath, "")
+
+	startDate := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	finishDate := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	items, err := source.LoadStock(startDate, finishDate)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(items) != 3 {
+		t.Fatalf("Expected 2 items inside the window and 1 carried into it, got %d", len(items))
+	}
+
+	if items[0].Период != "31.12.2023 23:59:59" || items[1].Период != "01.01.2024 00:00:00" || items[2].НоменклатураКод != "1002" {
+		t.Fatalf("Unexpected items kept: %+v", items)
+	}
+
+	all, err := source.LoadStock(time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(all) != 5 {
+		t.Fatalf("Expected open range to keep all 5 items, got %d", len(all))
+	}
+}
+
+func TestFileDataSource_LoadSales(t *testing.T) {
+	salesPath := writeDump(t, "sales.json", `[
+		{"Код": "1001", "Номенклатура": "Товар 1", "Количество": 2, "Сумма": 100},
+		{"Код": "1002", "Номенклатура": "Товар 2", "Количество": 1, "Сумма": 50}
+	]`)
+	source := NewFileDataSource("", salesPath)
+
+	items, err := source.LoadSales(time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(items) != 2 {
+		t.Fatalf("Expected 2 items, got %d", len(items))
+	}
+
+	if items[1].Сумма != 50 {
+		t.Fatalf("Expected sum 50, got %f", items[1].Сумма)
+	}
+}
+
+func TestFileDataSource_MalformedDump(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+	}{
+		{"not an array", `{"Код": "1001"}`},
+		{"broken element", `[{"Код": "1001"}, {"Код": 1002]`},
+		{"truncated", `[{"Код": "1001"}`},
+		{"empty", ``},
+	}
+
+	for _, tc := range testCases {
+		source := NewFileDataSource("", writeDump(t, "sales.json", tc.content))
+		if _, err := source.LoadSales(time.Time{}, time.Time{}); err == nil {
+			t.Fatalf("%s: expected error", tc.name)
+		}
+	}
+}
+
+func TestFileDataSource_LoadSales_FiltersByPeriod(t *testing.T) {
+	salesPath := writeDump(t, "sales.json", `[
+		{"Код": "1001", "Период": "31.12.2023 12:00:00", "Количество": 1, "Сумма": 10},
+		{"Код": "1001", "Период": "10.01.2024 12:00:00", "Количество": 1, "Сумма": 20},
+		{"Код": "1002", "Количество": 1, "Сумма": 30}
+	]`)
+	source := NewFileDataSource("", salesPath)
+
+	startDate := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	finishDate := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	items, err := source.LoadSales(startDate, finishDate)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(items) != 2 {
+		t.Fatalf("Expected dated row in window and undated row, got %d items", len(items))
+	}
+
+	if items[0].Сумма != 20 || items[1].Период != "" {
+		t.Fatalf("Unexpected items kept: %+v", items)
+	}
+}
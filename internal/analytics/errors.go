@@ -0,0 +1,11 @@
+package analytics
+
+// ValidationError reports a problem with the request itself rather than with
+// loading or processing data, so handlers can answer with 400.
+type ValidationError struct {
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
@@ -0,0 +1,120 @@
+package analytics
+
+import (
+	"math"
+	"sort"
+)
+
+func (s *Service) GetGroupAnalytics(req *ItemAnalyticsRequest) (*GroupAnalyticsResponse, error) {
+	query, err := newItemQuery(req)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := s.buildItemAnalytics(req)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := AggregateGroups(query.filter(items))
+
+	return &GroupAnalyticsResponse{
+		Groups: groups,
+		Total:  len(groups),
+	}, nil
+}
+
+// rollup accumulates item results. OSA is weighted by sales so that slow
+// movers do not drag the figure down; sets without sales fall back to the
+// plain average.
+type rollup struct {
+	items       int
+	sales       float64
+	loss        float64
+	quantity    float64
+	weightedOSA float64
+	plainOSA    float64
+	abc         map[string]int
+}
+
+func (r *rollup) add(item *ItemAnalyticsResult) {
+	r.items++
+	r.sales += item.Sales
+	r.loss += item.Loss
+	r.quantity += item.Quantity
+	r.weightedOSA += item.OSA * item.Sales
+	r.plainOSA += item.OSA
+	if item.ABC != "" {
+		if r.abc == nil {
+			r.abc = make(map[string]int)
+		}
+		r.abc[item.ABC]++
+	}
+}
+
+func (r *rollup) osa() float64 {
+	if r.items == 0 {
+		return 0
+	}
+	if r.sales > 0 {
+		return math.Round(r.weightedOSA/r.sales*100) / 100
+	}
+	return math.Round(r.plainOSA/float64(r.items)*100) / 100
+}
+
+func (r *rollup) lossOfProfit() float64 {
+	if r.sales <= 0 {
+		return 0
+	}
+	return math.Round((r.loss/r.sales)*100*1000) / 1000
+}
+
+func summarizeItems(items []ItemAnalyticsResult) AnalyticsTotals {
+	var r rollup
+	for i := range items {
+		r.add(&items[i])
+	}
+
+	return AnalyticsTotals{
+		Sales:        math.Round(r.sales*100) / 100,
+		Loss:         math.Round(r.loss*100) / 100,
+		LossOfProfit: r.lossOfProfit(),
+		Quantity:     math.Round(r.quantity*1000) / 1000,
+		OSA:          r.osa(),
+	}
+}
+
+// AggregateGroups rolls item results up by Group, largest sales first.
+func AggregateGroups(items []ItemAnalyticsResult) []GroupAnalyticsResult {
+	byGroup := make(map[string]*rollup)
+	for i := range items {
+		r, ok := byGroup[items[i].Group]
+		if !ok {
+			r = &rollup{abc: make(map[string]int)}
+			byGroup[items[i].Group] = r
+		}
+		r.add(&items[i])
+	}
+
+	groups := make([]GroupAnalyticsResult, 0, len(byGroup))
+	for name, r := range byGroup {
+		groups = append(groups, GroupAnalyticsResult{
+			Group:        name,
+			Items:        r.items,
+			Sales:        math.Round(r.sales*100) / 100,
+			Loss:         math.Round(r.loss*100) / 100,
+			LossOfProfit: r.lossOfProfit(),
+			OSA:          r.osa(),
+			ABC:          r.abc,
+		})
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Sales != groups[j].Sales {
+			return groups[i].Sales > groups[j].Sales
+		}
+		return groups[i].Group < groups[j].Group
+	})
+
+	return groups
+}
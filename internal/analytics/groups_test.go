@@ -0,0 +1,61 @@
+package analytics
+
+import "testing"
+
+func TestAggregateGroups(t *testing.T) {
+	items := []ItemAnalyticsResult{
+		{Code: "1", Group: "Молоко", Sales: 300, Loss: 30, OSA: 100, ABC: "A"},
+		{Code: "2", Group: "Молоко", Sales: 100, Loss: 10, OSA: 20, ABC: "B"},
+		{Code: "3", Group: "Хлеб", Sales: 50, Loss: 0, OSA: 50, ABC: "C"},
+		{Code: "4", Group: "Соль", Sales: 0, OSA: 40},
+		{Code: "5", Group: "Соль", Sales: 0, OSA: 60},
+	}
+
+	groups := AggregateGroups(items)
+
+	if len(groups) != 3 {
+		t.Fatalf("Expected 3 groups, got %d", len(groups))
+	}
+
+	milk := groups[0]
+	if milk.Group != "Молоко" || milk.Items != 2 || milk.Sales != 400 || milk.Loss != 40 {
+		t.Fatalf("Unexpected totals for first group: %+v", milk)
+	}
+
+	if milk.OSA != 80 {
+		t.Fatalf("Expected sales-weighted OSA 80, got %f", milk.OSA)
+	}
+
+	if milk.LossOfProfit != 10 {
+		t.Fatalf("Expected LossOfProfit 10, got %f", milk.LossOfProfit)
+	}
+
+	if milk.ABC["A"] != 1 || milk.ABC["B"] != 1 || milk.ABC["C"] != 0 {
+		t.Fatalf("Unexpected ABC mix: %v", milk.ABC)
+	}
+
+	salt := groups[2]
+	if salt.Group != "Соль" || salt.OSA != 50 {
+		t.Fatalf("Expected plain average OSA 50 for group without sales, got %+v", salt)
+	}
+}
+
+func TestService_GetGroupAnalytics(t *testing.T) {
+	service := NewService(createTestDataFiles(t))
+
+	response, err := service.GetGroupAnalytics(&ItemAnalyticsRequest{
+		StartDate:  "01.01.2024",
+		FinishDate: "31.01.2024",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if response.Total != 1 || response.Groups[0].Group != "Группа 1" {
+		t.Fatalf("Expected a single Группа 1 group, got %+v", response.Groups)
+	}
+
+	if response.Groups[0].Sales != 500 || response.Groups[0].ABC["C"] != 1 {
+		t.Fatalf("Unexpected group result: %+v", response.Groups[0])
+	}
+}
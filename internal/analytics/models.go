@@ -5,9 +5,49 @@ import (
 )
 
 type ItemAnalyticsRequest struct {
-	Token      string `json:"token"`
-	StartDate  string `json:"StartDate"`
-	FinishDate string `json:"FinishDate"`
+	Token      string      `json:"token"`
+	StartDate  string      `json:"StartDate"`
+	FinishDate string      `json:"FinishDate"`
+	ABC        *ABCOptions `json:"ABC,omitempty"`
+	XYZ        *XYZOptions `json:"XYZ,omitempty"`
+	Filter     *ItemFilter `json:"Filter,omitempty"`
+	SortBy     string      `json:"SortBy,omitempty"`
+	SortOrder  string      `json:"SortOrder,omitempty"`
+	Offset     int         `json:"Offset,omitempty"`
+	Limit      int         `json:"Limit,omitempty"`
+	Format     string      `json:"Format,omitempty"`
+}
+
+// ItemFilter narrows /analytics results. Empty fields do not filter; Name is
+// a case-insensitive substring match and range bounds are inclusive.
+type ItemFilter struct {
+	Groups   []string `json:"Groups,omitempty"`
+	ABC      []string `json:"ABC,omitempty"`
+	Codes    []string `json:"Codes,omitempty"`
+	Name     string   `json:"Name,omitempty"`
+	MinOSA   *float64 `json:"MinOSA,omitempty"`
+	MaxOSA   *float64 `json:"MaxOSA,omitempty"`
+	MinLoss  *float64 `json:"MinLoss,omitempty"`
+	MaxLoss  *float64 `json:"MaxLoss,omitempty"`
+	MinSales *float64 `json:"MinSales,omitempty"`
+	MaxSales *float64 `json:"MaxSales,omitempty"`
+}
+
+// ABCOptions overrides the default 80/95 ranking by sales. Thresholds are
+// cumulative share percentages, one fewer than Classes.
+type ABCOptions struct {
+	Metric     string    `json:"Metric,omitempty"`
+	Thresholds []float64 `json:"Thresholds,omitempty"`
+	Classes    int       `json:"Classes,omitempty"`
+}
+
+// XYZOptions controls demand-variability classification. Period is "day" or
+// "week"; thresholds are upper bounds of the coefficient of variation for the
+// X and Y classes.
+type XYZOptions struct {
+	Period     string  `json:"Period,omitempty"`
+	XThreshold float64 `json:"XThreshold,omitempty"`
+	YThreshold float64 `json:"YThreshold,omitempty"`
 }
 
 type StockItem struct {
@@ -23,6 +63,7 @@ type StockItem struct {
 type SalesItem struct {
 	Код         string  `json:"Код"`
 	Номенклатура string  `json:"Номенклатура"`
+	Период      string  `json:"Период,omitempty"`
 	Количество  float64 `json:"Количество"`
 	Сумма       float64 `json:"Сумма"`
 }
@@ -31,6 +72,7 @@ type StockEvent struct {
 	Time  time.Time `json:"time"`
 	Start float64   `json:"start"`
 	End   float64   `json:"end"`
+	Loss  float64   `json:"loss,omitempty"`
 }
 
 type ItemAnalyticsResult struct {
@@ -41,12 +83,75 @@ type ItemAnalyticsResult struct {
 	Loss         float64 `json:"Loss"`
 	LossOfProfit float64 `json:"LossOfProfit"`
 	OSA          float64 `json:"OSA"`
+	Quantity     float64 `json:"Quantity"`
 	ABC          string  `json:"ABC"`
+	XYZ          string  `json:"XYZ"`
+}
+
+type MatrixCell struct {
+	Items int     `json:"Items"`
+	Sales float64 `json:"Sales"`
+}
+
+type AnalyticsTotals struct {
+	Sales        float64 `json:"Sales"`
+	Loss         float64 `json:"Loss"`
+	LossOfProfit float64 `json:"LossOfProfit"`
+	Quantity     float64 `json:"Quantity"`
+	OSA          float64 `json:"OSA"`
 }
 
 type AnalyticsResponse struct {
-	Items []ItemAnalyticsResult `json:"items"`
-	Total int                   `json:"total"`
+	Items  []ItemAnalyticsResult `json:"items"`
+	Total  int                   `json:"total"`
+	Offset int                   `json:"offset,omitempty"`
+	Limit  int                   `json:"limit,omitempty"`
+	Totals AnalyticsTotals       `json:"totals"`
+	Matrix map[string]MatrixCell `json:"matrix"`
+}
+
+type GroupAnalyticsResult struct {
+	Group        string         `json:"Group"`
+	Items        int            `json:"Items"`
+	Sales        float64        `json:"Sales"`
+	Loss         float64        `json:"Loss"`
+	LossOfProfit float64        `json:"LossOfProfit"`
+	OSA          float64        `json:"OSA"`
+	ABC          map[string]int `json:"ABC"`
+}
+
+type GroupAnalyticsResponse struct {
+	Groups []GroupAnalyticsResult `json:"groups"`
+	Total  int                    `json:"total"`
+}
+
+type TimeSeriesRequest struct {
+	Token      string   `json:"token"`
+	StartDate  string   `json:"StartDate"`
+	FinishDate string   `json:"FinishDate"`
+	Interval   string   `json:"Interval,omitempty"`
+	Codes      []string `json:"Codes,omitempty"`
+}
+
+type TimeSeriesPoint struct {
+	Period       string  `json:"Period"`
+	OSA          float64 `json:"OSA"`
+	Sales        float64 `json:"Sales"`
+	Quantity     float64 `json:"Quantity"`
+	LossQuantity float64 `json:"LossQuantity"`
+}
+
+type ItemTimeSeries struct {
+	Name   string            `json:"Name"`
+	Code   string            `json:"Code"`
+	Group  string            `json:"Group"`
+	Points []TimeSeriesPoint `json:"Points"`
+}
+
+type TimeSeriesResponse struct {
+	Interval string           `json:"interval"`
+	Items    []ItemTimeSeries `json:"items"`
+	Total    int              `json:"total"`
 }
 
 type Chunk struct {
@@ -0,0 +1,113 @@
+package analytics
+
+import (
+	"encoding/json"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Fixtures in testdata/parity hold stock and sales rows together with the
+// output of the Python _prepare_data for them. Regenerate the expected part
+// with scripts/gen_parity_fixtures.py after changing the inputs.
+type parityFixture struct {
+	StartDate  string                `json:"StartDate"`
+	FinishDate string                `json:"FinishDate"`
+	Stock      []StockItem           `json:"stock"`
+	Sales      []SalesItem           `json:"sales"`
+	Expected   []ItemAnalyticsResult `json:"expected"`
+}
+
+func loadParityFixtures(t *testing.T) map[string]parityFixture {
+	paths, err := filepath.Glob(filepath.Join("testdata", "parity", "*.json"))
+	if err != nil {
+		t.Fatalf("Failed to list parity fixtures: %v", err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("Expected parity fixtures in testdata/parity")
+	}
+
+	fixtures := make(map[string]parityFixture, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", path, err)
+		}
+
+		var fixture parityFixture
+		if err := json.Unmarshal(data, &fixture); err != nil {
+			t.Fatalf("Failed to parse %s: %v", path, err)
+		}
+		fixtures[filepath.Base(path)] = fixture
+	}
+
+	return fixtures
+}
+
+func TestService_GetItemAnalytics_PythonParity(t *testing.T) {
+	for name, fixture := range loadParityFixtures(t) {
+		t.Run(name, func(t *testing.T) {
+			service := NewService(&MemoryDataSource{Stock: fixture.Stock, Sales: fixture.Sales})
+
+			response, err := service.GetItemAnalytics(&ItemAnalyticsRequest{
+				StartDate:  fixture.StartDate,
+				FinishDate: fixture.FinishDate,
+			})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if len(response.Items) != len(fixture.Expected) {
+				t.Fatalf("Expected %d items, got %d", len(fixture.Expected), len(response.Items))
+			}
+
+			for i, want := range fixture.Expected {
+				got := response.Items[i]
+				got.Quantity = 0
+				got.XYZ = ""
+				if got != want {
+					t.Fatalf("Item %d:\n  python: %+v\n  go:     %+v", i, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestService_GetItemAnalytics_Deterministic(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	for name, fixture := range loadParityFixtures(t) {
+		t.Run(name, func(t *testing.T) {
+			var first []ItemAnalyticsResult
+			for run := 0; run < 20; run++ {
+				stock := append([]StockItem(nil), fixture.Stock...)
+				sales := append([]SalesItem(nil), fixture.Sales...)
+				rng.Shuffle(len(stock), func(i, j int) { stock[i], stock[j] = stock[j], stock[i] })
+				rng.Shuffle(len(sales), func(i, j int) { sales[i], sales[j] = sales[j], sales[i] })
+
+				service := NewService(&MemoryDataSource{Stock: stock, Sales: sales})
+				service.SetWorkers(run%4 + 1)
+
+				response, err := service.GetItemAnalytics(&ItemAnalyticsRequest{
+					StartDate:  fixture.StartDate,
+					FinishDate: fixture.FinishDate,
+				})
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+
+				if first == nil {
+					first = response.Items
+					continue
+				}
+
+				for i := range first {
+					if response.Items[i] != first[i] {
+						t.Fatalf("Run %d item %d differs: %+v vs %+v", run, i, response.Items[i], first[i])
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package analytics
+
+import (
+	"cmp"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var itemSortKeys = map[string]func(a, b *ItemAnalyticsResult) int{
+	"Name":         func(a, b *ItemAnalyticsResult) int { return cmp.Compare(a.Name, b.Name) },
+	"Code":         func(a, b *ItemAnalyticsResult) int { return cmp.Compare(a.Code, b.Code) },
+	"Group":        func(a, b *ItemAnalyticsResult) int { return cmp.Compare(a.Group, b.Group) },
+	"Sales":        func(a, b *ItemAnalyticsResult) int { return cmp.Compare(a.Sales, b.Sales) },
+	"Loss":         func(a, b *ItemAnalyticsResult) int { return cmp.Compare(a.Loss, b.Loss) },
+	"LossOfProfit": func(a, b *ItemAnalyticsResult) int { return cmp.Compare(a.LossOfProfit, b.LossOfProfit) },
+	"OSA":          func(a, b *ItemAnalyticsResult) int { return cmp.Compare(a.OSA, b.OSA) },
+	"Quantity":     func(a, b *ItemAnalyticsResult) int { return cmp.Compare(a.Quantity, b.Quantity) },
+	"ABC":          func(a, b *ItemAnalyticsResult) int { return cmp.Compare(a.ABC, b.ABC) },
+	"XYZ":          func(a, b *ItemAnalyticsResult) int { return cmp.Compare(a.XYZ, b.XYZ) },
+}
+
+type itemQuery struct {
+	groups  map[string]bool
+	abc     map[string]bool
+	codes   map[string]bool
+	name    string
+	bounds  ItemFilter
+	compare func(a, b *ItemAnalyticsResult) int
+	desc    bool
+	offset  int
+	limit   int
+}
+
+func newItemQuery(req *ItemAnalyticsRequest) (*itemQuery, error) {
+	q := &itemQuery{
+		compare: itemSortKeys["Sales"],
+		desc:    true,
+		offset:  req.Offset,
+		limit:   req.Limit,
+	}
+
+	if req.Offset < 0 {
+		return nil, &ValidationError{Message: fmt.Sprintf("Offset must not be negative, got %d", req.Offset)}
+	}
+	if req.Limit < 0 {
+		return nil, &ValidationError{Message: fmt.Sprintf("Limit must not be negative, got %d", req.Limit)}
+	}
+
+	if req.SortBy != "" {
+		compare, ok := itemSortKeys[req.SortBy]
+		if !ok {
+			fields := make([]string, 0, len(itemSortKeys))
+			for field := range itemSortKeys {
+				fields = append(fields, field)
+			}
+			sort.Strings(fields)
+			return nil, &ValidationError{Message: fmt.Sprintf("unknown SortBy %q, expected one of %s", req.SortBy, strings.Join(fields, ", "))}
+		}
+		q.compare = compare
+		q.desc = false
+	}
+
+	switch strings.ToLower(req.SortOrder) {
+	case "":
+	case "asc":
+		q.desc = false
+	case "desc":
+		q.desc = true
+	default:
+		return nil, &ValidationError{Message: fmt.Sprintf("SortOrder must be asc or desc, got %q", req.SortOrder)}
+	}
+
+	if req.Filter == nil {
+		return q, nil
+	}
+
+	f := req.Filter
+	if err := checkRange("OSA", f.MinOSA, f.MaxOSA); err != nil {
+		return nil, err
+	}
+	if err := checkRange("Loss", f.MinLoss, f.MaxLoss); err != nil {
+		return nil, err
+	}
+	if err := checkRange("Sales", f.MinSales, f.MaxSales); err != nil {
+		return nil, err
+	}
+
+	q.groups = toSet(f.Groups)
+	q.codes = toSet(f.Codes)
+	q.abc = toSet(f.ABC)
+	for class := range q.abc {
+		if len(class) != 1 || class[0] < 'A' || class[0] > 'E' {
+			return nil, &ValidationError{Message: fmt.Sprintf("Filter.ABC contains unknown class %q", class)}
+		}
+	}
+	q.name = strings.ToLower(strings.TrimSpace(f.Name))
+	q.bounds = *f
+
+	return q, nil
+}
+
+func checkRange(field string, min, max *float64) error {
+	if min != nil && max != nil && *min > *max {
+		return &ValidationError{Message: fmt.Sprintf("Filter.Min%s (%g) is greater than Filter.Max%s (%g)", field, *min, field, *max)}
+	}
+	return nil
+}
+
+func toSet(values []string) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[strings.TrimSpace(v)] = true
+	}
+	return set
+}
+
+func inRange(value float64, min, max *float64) bool {
+	if min != nil && value < *min {
+		return false
+	}
+	if max != nil && value > *max {
+		return false
+	}
+	return true
+}
+
+// filter keeps matching items in place and returns the shortened slice.
+func (q *itemQuery) filter(items []ItemAnalyticsResult) []ItemAnalyticsResult {
+	kept := items[:0]
+	for _, item := range items {
+		if q.groups != nil && !q.groups[item.Group] {
+			continue
+		}
+		if q.abc != nil && !q.abc[item.ABC] {
+			continue
+		}
+		if q.codes != nil && !q.codes[item.Code] {
+			continue
+		}
+		if q.name != "" && !strings.Contains(strings.ToLower(item.Name), q.name) {
+			continue
+		}
+		if !inRange(item.OSA, q.bounds.MinOSA, q.bounds.MaxOSA) ||
+			!inRange(item.Loss, q.bounds.MinLoss, q.bounds.MaxLoss) ||
+			!inRange(item.Sales, q.bounds.MinSales, q.bounds.MaxSales) {
+			continue
+		}
+		kept = append(kept, item)
+	}
+	return kept
+}
+
+// sort orders items by the requested field with ties broken by code, so pages
+// stay stable between requests.
+func (q *itemQuery) sort(items []ItemAnalyticsResult) {
+	sort.SliceStable(items, func(i, j int) bool {
+		c := q.compare(&items[i], &items[j])
+		if c == 0 {
+			return items[i].Code < items[j].Code
+		}
+		if q.desc {
+			return c > 0
+		}
+		return c < 0
+	})
+}
+
+func (q *itemQuery) page(items []ItemAnalyticsResult) []ItemAnalyticsResult {
+	if q.offset >= len(items) {
+		return []ItemAnalyticsResult{}
+	}
+	items = items[q.offset:]
+	if q.limit > 0 && q.limit < len(items) {
+		items = items[:q.limit]
+	}
+	return items
+}
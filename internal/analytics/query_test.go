@@ -0,0 +1,142 @@
+package analytics
+
+import (
+	"errors"
+	"testing"
+)
+
+func queryTestService() *Service {
+	return NewService(&MemoryDataSource{
+		Stock: []StockItem{
+			{НоменклатураКод: "1001", Родитель: "Молочные", Период: "01.01.2024 00:00:00", КонечныйОстаток: 10},
+			{НоменклатураКод: "1002", Родитель: "Молочные", Период: "01.01.2024 00:00:00", КонечныйОстаток: 0},
+			{НоменклатураКод: "1003", Родитель: "Хлеб", Период: "01.01.2024 00:00:00", КонечныйОстаток: 10},
+			{НоменклатураКод: "1004", Родитель: "Хлеб", Период: "01.01.2024 00:00:00", КонечныйОстаток: 10},
+		},
+		Sales: []SalesItem{
+			{Код: "1001", Номенклатура: "Молоко 1л", Период: "01.01.2024", Количество: 10, Сумма: 1000},
+			{Код: "1002", Номенклатура: "Кефир", Период: "01.01.2024", Количество: 4, Сумма: 400},
+			{Код: "1003", Номенклатура: "Хлеб белый", Период: "01.01.2024", Количество: 20, Сумма: 300},
+			{Код: "1004", Номенклатура: "Хлеб ржаной", Период: "01.01.2024", Количество: 5, Сумма: 100},
+		},
+	})
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+func TestService_GetItemAnalytics_Filter(t *testing.T) {
+	service := queryTestService()
+
+	response, err := service.GetItemAnalytics(&ItemAnalyticsRequest{
+		StartDate:  "01.01.2024",
+		FinishDate: "01.01.2024",
+		Filter:     &ItemFilter{Name: "ХЛЕБ"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if response.Total != 2 || response.Items[0].Code != "1003" || response.Items[1].Code != "1004" {
+		t.Fatalf("Expected bread items 1003 and 1004, got %+v", response.Items)
+	}
+
+	if response.Totals.Sales != 400 || response.Totals.Quantity != 25 {
+		t.Fatalf("Expected totals over filtered items, got %+v", response.Totals)
+	}
+
+	if response.Items[0].ABC != "B" {
+		t.Fatalf("Expected ABC to be computed before filtering, got %s", response.Items[0].ABC)
+	}
+
+	response, err = service.GetItemAnalytics(&ItemAnalyticsRequest{
+		StartDate:  "01.01.2024",
+		FinishDate: "01.01.2024",
+		Filter: &ItemFilter{
+			Groups:   []string{"Молочные", "Хлеб"},
+			MaxOSA:   floatPtr(50),
+			MinSales: floatPtr(100),
+		},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if response.Total != 1 || response.Items[0].Code != "1002" {
+		t.Fatalf("Expected only out-of-stock 1002, got %+v", response.Items)
+	}
+
+	response, err = service.GetItemAnalytics(&ItemAnalyticsRequest{
+		StartDate:  "01.01.2024",
+		FinishDate: "01.01.2024",
+		Filter:     &ItemFilter{ABC: []string{"A"}, Codes: []string{"1001", "1003"}},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if response.Total != 1 || response.Items[0].Code != "1001" {
+		t.Fatalf("Expected only 1001, got %+v", response.Items)
+	}
+}
+
+func TestService_GetItemAnalytics_SortAndPage(t *testing.T) {
+	service := queryTestService()
+
+	response, err := service.GetItemAnalytics(&ItemAnalyticsRequest{
+		StartDate:  "01.01.2024",
+		FinishDate: "01.01.2024",
+		SortBy:     "Quantity",
+		SortOrder:  "desc",
+		Offset:     1,
+		Limit:      2,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if response.Total != 4 {
+		t.Fatalf("Expected total to count all items, got %d", response.Total)
+	}
+
+	if len(response.Items) != 2 || response.Items[0].Code != "1001" || response.Items[1].Code != "1004" {
+		t.Fatalf("Expected page [1001 1004], got %+v", response.Items)
+	}
+
+	if response.Totals.Sales != 1800 {
+		t.Fatalf("Expected totals over all filtered items, got %+v", response.Totals)
+	}
+
+	response, err = service.GetItemAnalytics(&ItemAnalyticsRequest{
+		StartDate:  "01.01.2024",
+		FinishDate: "01.01.2024",
+		SortBy:     "Name",
+		Offset:     10,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(response.Items) != 0 || response.Total != 4 {
+		t.Fatalf("Expected empty page past the end, got %+v", response)
+	}
+}
+
+func TestNewItemQuery_Invalid(t *testing.T) {
+	testCases := []ItemAnalyticsRequest{
+		{SortBy: "Price"},
+		{SortOrder: "up"},
+		{Offset: -1},
+		{Limit: -5},
+		{Filter: &ItemFilter{MinOSA: floatPtr(90), MaxOSA: floatPtr(10)}},
+		{Filter: &ItemFilter{ABC: []string{"Z"}}},
+	}
+
+	for _, tc := range testCases {
+		var validationErr *ValidationError
+		if _, err := newItemQuery(&tc); !errors.As(err, &validationErr) {
+			t.Fatalf("Expected validation error for %+v, got %v", tc, err)
+		}
+	}
+}
@@ -1,30 +1,31 @@
 package analytics
 
 import (
-	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"math"
-	"os"
 	"runtime"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Service struct {
 	workers int
+	source  DataSource
+	dataset atomic.Pointer[dataset]
 }
 
-func NewService() *Service {
+func NewService(source DataSource) *Service {
 	workers := runtime.NumCPU()
 	if workers < 2 {
 		workers = 2
 	}
 	return &Service{
 		workers: workers,
+		source:  source,
 	}
 }
 
@@ -37,26 +38,57 @@ func (s *Service) SetWorkers(workers int) {
 func (s *Service) GetItemAnalytics(req *ItemAnalyticsRequest) (*AnalyticsResponse, error) {
 	startTime := time.Now()
 	
-	startDate, err := time.Parse("02.01.2006", req.StartDate)
+	query, err := newItemQuery(req)
 	if err != nil {
-		return nil, fmt.Errorf("invalid start date format: %w", err)
+		return nil, err
 	}
 	
-	finishDate, err := time.Parse("02.01.2006", req.FinishDate)
+	items, err := s.buildItemAnalytics(req)
 	if err != nil {
-		return nil, fmt.Errorf("invalid finish date format: %w", err)
+		return nil, err
 	}
 	
-	finishDate = finishDate.Add(24 * time.Hour)
+	generated := len(items)
+	items = query.filter(items)
+	query.sort(items)
+	
+	response := &AnalyticsResponse{
+		Items:  query.page(items),
+		Total:  len(items),
+		Offset: query.offset,
+		Limit:  query.limit,
+		Totals: summarizeItems(items),
+		Matrix: buildABCXYZMatrix(items),
+	}
+	
+	processingTime := time.Since(startTime)
+	log.Printf("Analytics processing completed in %v", processingTime)
+	log.Printf("Generated %d analytics items, %d after filtering", generated, response.Total)
+	
+	return response, nil
+}
+
+// buildItemAnalytics computes classified results for every item in the window,
+// ordered by sales with ties broken by code.
+func (s *Service) buildItemAnalytics(req *ItemAnalyticsRequest) ([]ItemAnalyticsResult, error) {
+	startDate, finishDate, err := parseDateRange(req.StartDate, req.FinishDate)
+	if err != nil {
+		return nil, err
+	}
 	
-	stockData, err := s.loadStockData()
+	abcConfig, err := resolveABCOptions(req.ABC)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load stock data: %w", err)
+		return nil, err
 	}
 	
-	salesData, err := s.loadSalesData()
+	xyzStep, xThreshold, yThreshold, err := resolveXYZOptions(req.XYZ)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load sales data: %w", err)
+		return nil, err
+	}
+	
+	stockData, salesData, err := s.loadData(startDate, finishDate)
+	if err != nil {
+		return nil, err
 	}
 	
 	log.Printf("Loaded %d stock items and %d sales items", len(stockData), len(salesData))
@@ -67,124 +99,92 @@ func (s *Service) GetItemAnalytics(req *ItemAnalyticsRequest) (*AnalyticsRespons
 		return nil, fmt.Errorf("failed to process data: %w", err)
 	}
 	
-	s.calculateABCClassification(items)
+	s.classifyABC(items, abcConfig)
+	s.calculateXYZClassification(items, salesData, startDate, finishDate, xyzStep, xThreshold, yThreshold)
 	
 	sort.Slice(items, func(i, j int) bool {
-		return items[i].Sales > items[j].Sales
+		if items[i].Sales != items[j].Sales {
+			return items[i].Sales > items[j].Sales
+		}
+		return items[i].Code < items[j].Code
 	})
 	
-	processingTime := time.Since(startTime)
-	log.Printf("Analytics processing completed in %v", processingTime)
-	log.Printf("Generated %d analytics items", len(items))
-	
-	return &AnalyticsResponse{
-		Items: items,
-		Total: len(items),
-	}, nil
+	return items, nil
 }
 
-func (s *Service) loadStockData() ([]StockItem, error) {
-	file, err := os.Open("routes/stock_dump.json")
+func parseDateRange(start, finish string) (time.Time, time.Time, error) {
+	startDate, err := time.Parse("02.01.2006", start)
 	if err != nil {
-		return nil, err
+		return time.Time{}, time.Time{}, &ValidationError{Message: fmt.Sprintf("invalid start date format: %v", err)}
 	}
-	defer file.Close()
 	
-	data, err := io.ReadAll(file)
+	finishDate, err := time.Parse("02.01.2006", finish)
 	if err != nil {
-		return nil, err
+		return time.Time{}, time.Time{}, &ValidationError{Message: fmt.Sprintf("invalid finish date format: %v", err)}
 	}
 	
-	var items []StockItem
-	if err := json.Unmarshal(data, &items); err != nil {
-		return nil, err
+	finishDate = finishDate.Add(24 * time.Hour)
+	if !finishDate.After(startDate) {
+		return time.Time{}, time.Time{}, &ValidationError{Message: "FinishDate must not be before StartDate"}
 	}
 	
-	return items, nil
+	return startDate, finishDate, nil
 }
 
-func (s *Service) loadSalesData() ([]SalesItem, error) {
-	file, err := os.Open("routes/sales_dump.json")
-	if err != nil {
-		return nil, err
+func (s *Service) loadData(startDate, finishDate time.Time) ([]StockItem, []SalesItem, error) {
+	if snapshot := s.dataset.Load(); snapshot != nil {
+		return snapshot.stock, snapshot.sales, nil
 	}
-	defer file.Close()
 	
-	data, err := io.ReadAll(file)
+	stockData, err := s.source.LoadStock(startDate, finishDate)
 	if err != nil {
-		return nil, err
+		return nil, nil, fmt.Errorf("failed to load stock data: %w", err)
 	}
 	
-	var items []SalesItem
-	if err := json.Unmarshal(data, &items); err != nil {
-		return nil, err
+	salesData, err := s.source.LoadSales(startDate, finishDate)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load sales data: %w", err)
 	}
 	
-	return items, nil
+	return stockData, salesData, nil
 }
 
 func (s *Service) processDataParallel(stockData []StockItem, salesData []SalesItem, startDate, finishDate time.Time) ([]ItemAnalyticsResult, error) {
-	chunks := s.splitIntoChunks(stockData)
-	
-	results := make(chan ProcessedChunk, len(chunks))
-	chunkChan := make(chan Chunk, len(chunks))
-	var wg sync.WaitGroup
-	
-	for i := 0; i < s.workers; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for chunk := range chunkChan {
-				processed := s.processChunk(chunk, startDate, finishDate)
-				results <- processed
-			}
-		}()
-	}
-	
-	go func() {
-		for _, chunk := range chunks {
-			chunkChan <- chunk
-		}
-		close(chunkChan)
-	}()
-	
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
-	
-	allEvents := make(map[string][]StockEvent)
-	allLosses := make(map[string]float64)
-	
-	for result := range results {
-		for code, events := range result.Events {
-			allEvents[code] = append(allEvents[code], events...)
-		}
-		for code, loss := range result.Losses {
-			allLosses[code] += loss
-		}
-	}
+	allEvents, allLosses := s.collectEvents(stockData, startDate, finishDate)
 	
 	salesByCode := make(map[string]float64)
 	salesQtyByCode := make(map[string]float64)
 	nameByCode := make(map[string]string)
 	groupByCode := make(map[string]string)
 	
+	undatedSales := 0
 	for _, item := range salesData {
 		code := strings.TrimSpace(item.Код)
 		if code == "" {
 			continue
 		}
 		
+		if item.Период == "" {
+			undatedSales++
+		} else if !inPeriod(item.Период, startDate, finishDate) {
+			continue
+		}
+		
 		salesByCode[code] += item.Сумма
 		salesQtyByCode[code] += item.Количество
 		nameByCode[code] = item.Номенклатура
 	}
 	
+	if undatedSales > 0 {
+		log.Printf("Warning: %d sales rows have no Период, counting them regardless of the date range", undatedSales)
+	}
+	
+	stockNameByCode := make(map[string]string)
 	for _, item := range stockData {
 		code := strings.TrimSpace(item.НоменклатураКод)
 		if code != "" {
 			groupByCode[code] = item.Родитель
+			stockNameByCode[code] = item.Номенклатура
 		}
 	}
 	
@@ -204,6 +204,9 @@ func (s *Service) processDataParallel(stockData []StockItem, salesData []SalesIt
 		osa := s.calculateOSA(allEvents[code], startDate, finishDate)
 		
 		name := nameByCode[code]
+		if name == "" {
+			name = stockNameByCode[code]
+		}
 		if name == "" {
 			name = code
 		}
@@ -226,12 +229,58 @@ func (s *Service) processDataParallel(stockData []StockItem, salesData []SalesIt
 			Loss:         math.Round(lossAmount*100) / 100,
 			LossOfProfit: math.Round(lossPercent*1000) / 1000,
 			OSA:          osa,
+			Quantity:     math.Round(salesQtyByCode[code]*1000) / 1000,
 		})
 	}
 	
 	return items, nil
 }
 
+func (s *Service) collectEvents(stockData []StockItem, startDate, finishDate time.Time) (map[string][]StockEvent, map[string]float64) {
+	chunks := s.splitIntoChunks(stockData)
+	
+	results := make(chan ProcessedChunk, len(chunks))
+	chunkChan := make(chan Chunk, len(chunks))
+	var wg sync.WaitGroup
+	
+	for i := 0; i < s.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range chunkChan {
+				processed := s.processChunk(chunk, startDate, finishDate)
+				results <- processed
+			}
+		}()
+	}
+	
+	go func() {
+		for _, chunk := range chunks {
+			chunkChan <- chunk
+		}
+		close(chunkChan)
+	}()
+	
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	
+	allEvents := make(map[string][]StockEvent)
+	allLosses := make(map[string]float64)
+	
+	for result := range results {
+		for code, events := range result.Events {
+			allEvents[code] = append(allEvents[code], events...)
+		}
+		for code, loss := range result.Losses {
+			allLosses[code] += loss
+		}
+	}
+	
+	return allEvents, allLosses
+}
+
 func (s *Service) splitIntoChunks(data []StockItem) []Chunk {
 	chunkSize := (len(data) + s.workers - 1) / s.workers
 	var chunks []Chunk
@@ -266,18 +315,25 @@ func (s *Service) processChunk(chunk Chunk, startDate, finishDate time.Time) Pro
 			continue
 		}
 		
-		events[code] = append(events[code], StockEvent{
+		event := StockEvent{
 			Time:  *dt,
 			Start: item.НачальныйОстаток,
 			End:   item.КонечныйОстаток,
-		})
+		}
 		
 		if item.СтатьяРасходов == "Порча на складах (94)" {
 			diff := item.НачальныйОстаток - item.КонечныйОстаток
 			if diff > 0 {
-				losses[code] += diff
+				event.Loss = diff
+				// The cache hands over the whole dump, so spoilage
+				// outside the window must not count towards Loss.
+				if !dt.Before(startDate) && dt.Before(finishDate) {
+					losses[code] += diff
+				}
 			}
 		}
+		
+		events[code] = append(events[code], event)
 	}
 	
 	return ProcessedChunk{
@@ -288,6 +344,10 @@ func (s *Service) processChunk(chunk Chunk, startDate, finishDate time.Time) Pro
 }
 
 func (s *Service) parseDateTime(dateStr string) *time.Time {
+	return parsePeriod(dateStr)
+}
+
+func parsePeriod(dateStr string) *time.Time {
 	formats := []string{
 		"02.01.2006 15:04:05",
 		"02.01.2006 15:04",
@@ -347,30 +407,5 @@ func (s *Service) calculateOSA(events []StockEvent, startDate, finishDate time.T
 }
 
 func (s *Service) calculateABCClassification(items []ItemAnalyticsResult) {
-	if len(items) == 0 {
-		return
-	}
-	
-	totalSales := 0.0
-	for _, item := range items {
-		totalSales += item.Sales
-	}
-	
-	if totalSales <= 0 {
-		return
-	}
-	
-	cumulative := 0.0
-	for i := range items {
-		cumulative += items[i].Sales
-		share := (cumulative / totalSales) * 100
-		
-		if share <= 80 {
-			items[i].ABC = "A"
-		} else if share <= 95 {
-			items[i].ABC = "B"
-		} else {
-			items[i].ABC = "C"
-		}
-	}
+	s.classifyABC(items, defaultABCConfig())
 }
@@ -2,12 +2,13 @@ package analytics
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
 
 func TestService_NewService(t *testing.T) {
-	service := NewService()
+	service := NewService(&MemoryDataSource{})
 	
 	if service.workers <= 0 {
 		t.Fatalf("Expected positive number of workers, got %d", service.workers)
@@ -15,7 +16,7 @@ func TestService_NewService(t *testing.T) {
 }
 
 func TestService_SetWorkers(t *testing.T) {
-	service := NewService()
+	service := NewService(&MemoryDataSource{})
 	
 	service.SetWorkers(8)
 	if service.workers != 8 {
@@ -29,7 +30,7 @@ func TestService_SetWorkers(t *testing.T) {
 }
 
 func TestService_parseDateTime(t *testing.T) {
-	service := NewService()
+	service := NewService(&MemoryDataSource{})
 	
 	testCases := []struct {
 		input    string
@@ -54,7 +55,7 @@ func TestService_parseDateTime(t *testing.T) {
 }
 
 func TestService_calculateOSA(t *testing.T) {
-	service := NewService()
+	service := NewService(&MemoryDataSource{})
 	
 	startDate := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
 	endDate := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
@@ -84,7 +85,7 @@ func TestService_calculateOSA(t *testing.T) {
 }
 
 func TestService_calculateABCClassification(t *testing.T) {
-	service := NewService()
+	service := NewService(&MemoryDataSource{})
 	
 	items := []ItemAnalyticsResult{}
 	service.calculateABCClassification(items)
@@ -109,7 +110,7 @@ func TestService_calculateABCClassification(t *testing.T) {
 }
 
 func TestService_splitIntoChunks(t *testing.T) {
-	service := NewService()
+	service := NewService(&MemoryDataSource{})
 	service.SetWorkers(2)
 	
 	stockData := []StockItem{
@@ -136,7 +137,7 @@ func TestService_splitIntoChunks(t *testing.T) {
 }
 
 func TestService_processChunk(t *testing.T) {
-	service := NewService()
+	service := NewService(&MemoryDataSource{})
 	
 	startDate := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
 	endDate := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
@@ -166,7 +167,7 @@ func TestService_processChunk(t *testing.T) {
 }
 
 func TestService_GetItemAnalytics_InvalidDates(t *testing.T) {
-	service := NewService()
+	service := NewService(&MemoryDataSource{})
 	
 	req := &ItemAnalyticsRequest{
 		Token:      "test-token",
@@ -188,10 +189,8 @@ func TestService_GetItemAnalytics_InvalidDates(t *testing.T) {
 	}
 }
 
-func createTestDataFiles(t *testing.T) {
-	if err := os.MkdirAll("routes", 0755); err != nil {
-		t.Fatalf("Failed to create routes directory: %v", err)
-	}
+func createTestDataFiles(t *testing.T) *FileDataSource {
+	dir := t.TempDir()
 	
 	stockData := `[
 		{
@@ -204,7 +203,8 @@ func createTestDataFiles(t *testing.T) {
 		}
 	]`
 	
-	err := os.WriteFile("routes/stock_dump.json", []byte(stockData), 0644)
+	stockPath := filepath.Join(dir, "stock_dump.json")
+	err := os.WriteFile(stockPath, []byte(stockData), 0644)
 	if err != nil {
 		t.Fatalf("Failed to create test stock file: %v", err)
 	}
@@ -218,24 +218,17 @@ func createTestDataFiles(t *testing.T) {
 		}
 	]`
 	
-	err = os.WriteFile("routes/sales_dump.json", []byte(salesData), 0644)
+	salesPath := filepath.Join(dir, "sales_dump.json")
+	err = os.WriteFile(salesPath, []byte(salesData), 0644)
 	if err != nil {
 		t.Fatalf("Failed to create test sales file: %v", err)
 	}
-}
-
-func cleanupTestDataFiles(t *testing.T) {
-	os.Remove("routes/stock_dump.json")
-	os.Remove("routes/sales_dump.json")
+	
+	return NewFileDataSource(stockPath, salesPath)
 }
 
 func TestService_GetItemAnalytics_Integration(t *testing.T) {
-	createTestDataFiles(t)
-	t.Cleanup(func() {
-		cleanupTestDataFiles(t)
-	})
-	
-	service := NewService()
+	service := NewService(createTestDataFiles(t))
 	
 	req := &ItemAnalyticsRequest{
 		Token:      "test-token",
@@ -255,4 +248,64 @@ func TestService_GetItemAnalytics_Integration(t *testing.T) {
 	if response.Total < 0 {
 		t.Fatalf("Expected non-negative total, got %d", response.Total)
 	}
+	
+	if response.Total != 1 {
+		t.Fatalf("Expected 1 item, got %d", response.Total)
+	}
+	
+	if response.Items[0].Group != "Группа 1" {
+		t.Fatalf("Expected group from stock data, got %s", response.Items[0].Group)
+	}
+}
+
+func TestService_GetItemAnalytics_MissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	service := NewService(NewFileDataSource(filepath.Join(dir, "stock.json"), filepath.Join(dir, "sales.json")))
+	
+	req := &ItemAnalyticsRequest{
+		StartDate:  "01.01.2024",
+		FinishDate: "31.01.2024",
+	}
+	
+	if _, err := service.GetItemAnalytics(req); err == nil {
+		t.Fatal("Expected error for missing dump files")
+	}
+}
+
+func TestService_processDataParallel_FiltersSalesByPeriod(t *testing.T) {
+	service := NewService(&MemoryDataSource{})
+	
+	startDate := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	endDate := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	
+	salesData := []SalesItem{
+		{Код: "1001", Период: "31.12.2023 23:00:00", Количество: 1, Сумма: 1000},
+		{Код: "1001", Период: "01.01.2024 10:00:00", Количество: 2, Сумма: 200},
+		{Код: "1001", Период: "01.01.2024", Количество: 1, Сумма: 100},
+		{Код: "1001", Период: "02.01.2024 00:00:00", Количество: 5, Сумма: 5000},
+		{Код: "1002", Период: "15.01.2024", Количество: 1, Сумма: 50},
+		{Код: "1003", Количество: 1, Сумма: 30},
+	}
+	
+	items, err := service.processDataParallel(nil, salesData, startDate, endDate)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	
+	sales := make(map[string]float64)
+	for _, item := range items {
+		sales[item.Code] = item.Sales
+	}
+	
+	if len(sales) != 2 {
+		t.Fatalf("Expected 2 items with sales in the window, got %d", len(sales))
+	}
+	
+	if sales["1001"] != 300 {
+		t.Fatalf("Expected sales 300 for 1001, got %f", sales["1001"])
+	}
+	
+	if sales["1003"] != 30 {
+		t.Fatalf("Expected undated sales to be counted for 1003, got %f", sales["1003"])
+	}
 }
@@ -0,0 +1,231 @@
+package analytics
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Every item gets one point per bucket, so the range bounds the response
+// size for either interval.
+const (
+	maxHourlyRange = 31 * 24 * time.Hour
+	maxDailyRange  = 366 * 24 * time.Hour
+)
+
+func (s *Service) GetTimeSeries(req *TimeSeriesRequest) (*TimeSeriesResponse, error) {
+	startTime := time.Now()
+
+	startDate, finishDate, err := parseDateRange(req.StartDate, req.FinishDate)
+	if err != nil {
+		return nil, err
+	}
+
+	interval := req.Interval
+	if interval == "" {
+		interval = "day"
+	}
+
+	var step time.Duration
+	var layout string
+	switch interval {
+	case "day":
+		step = 24 * time.Hour
+		layout = "02.01.2006"
+		if finishDate.Sub(startDate) > maxDailyRange {
+			return nil, &ValidationError{Message: "daily interval is limited to 366 days"}
+		}
+	case "hour":
+		step = time.Hour
+		layout = "02.01.2006 15:04"
+		if finishDate.Sub(startDate) > maxHourlyRange {
+			return nil, &ValidationError{Message: "hourly interval is limited to 31 days"}
+		}
+	default:
+		return nil, &ValidationError{Message: fmt.Sprintf("unknown interval %q, expected day or hour", req.Interval)}
+	}
+
+	stockData, salesData, err := s.loadData(startDate, finishDate)
+	if err != nil {
+		return nil, err
+	}
+
+	var wanted map[string]bool
+	if len(req.Codes) > 0 {
+		wanted = make(map[string]bool, len(req.Codes))
+		for _, code := range req.Codes {
+			wanted[strings.TrimSpace(code)] = true
+		}
+	}
+
+	buckets := int(finishDate.Sub(startDate) / step)
+	series := make(map[string]*ItemTimeSeries)
+	seriesFor := func(code string) *ItemTimeSeries {
+		if item, ok := series[code]; ok {
+			return item
+		}
+		points := make([]TimeSeriesPoint, buckets)
+		for i := range points {
+			points[i].Period = startDate.Add(time.Duration(i) * step).Format(layout)
+		}
+		item := &ItemTimeSeries{Code: code, Points: points}
+		series[code] = item
+		return item
+	}
+
+	undatedSales := 0
+	nameByCode := make(map[string]string)
+	for _, sale := range salesData {
+		code := strings.TrimSpace(sale.Код)
+		if code == "" || (wanted != nil && !wanted[code]) {
+			continue
+		}
+
+		dt := parsePeriod(sale.Период)
+		if dt == nil {
+			undatedSales++
+			continue
+		}
+		if dt.Before(startDate) || !dt.Before(finishDate) {
+			continue
+		}
+
+		point := &seriesFor(code).Points[int(dt.Sub(startDate)/step)]
+		point.Sales += sale.Сумма
+		point.Quantity += sale.Количество
+		nameByCode[code] = sale.Номенклатура
+	}
+
+	if undatedSales > 0 {
+		log.Printf("Warning: %d sales rows have no Период and were left out of the time series", undatedSales)
+	}
+
+	allEvents, _ := s.collectEvents(stockData, startDate, finishDate)
+	for code, events := range allEvents {
+		if wanted != nil && !wanted[code] {
+			continue
+		}
+
+		sort.Slice(events, func(i, j int) bool {
+			return events[i].Time.Before(events[j].Time)
+		})
+
+		inWindow := false
+		for _, event := range events {
+			if !event.Time.Before(startDate) && event.Time.Before(finishDate) {
+				inWindow = true
+				break
+			}
+		}
+		// An item sold in the window but without stock movements in it
+		// still has the balance it entered with, as in calculateOSA.
+		if _, sold := series[code]; !inWindow && !sold {
+			continue
+		}
+
+		item := seriesFor(code)
+		avail := bucketAvailability(events, startDate, finishDate, step, buckets)
+		for i, hours := range avail {
+			item.Points[i].OSA = math.Round((hours/step.Hours())*10000) / 100
+		}
+
+		for _, event := range events {
+			if event.Loss > 0 && !event.Time.Before(startDate) && event.Time.Before(finishDate) {
+				item.Points[int(event.Time.Sub(startDate)/step)].LossQuantity += event.Loss
+			}
+		}
+	}
+
+	for _, stock := range stockData {
+		code := strings.TrimSpace(stock.НоменклатураКод)
+		item, ok := series[code]
+		if !ok {
+			continue
+		}
+		item.Group = stock.Родитель
+		if nameByCode[code] == "" {
+			nameByCode[code] = stock.Номенклатура
+		}
+	}
+
+	items := make([]ItemTimeSeries, 0, len(series))
+	for code, item := range series {
+		item.Name = nameByCode[code]
+		if item.Name == "" {
+			item.Name = code
+		}
+		if item.Group == "" {
+			item.Group = "Без группы 🤔"
+		}
+		for i := range item.Points {
+			item.Points[i].Sales = math.Round(item.Points[i].Sales*100) / 100
+		}
+		items = append(items, *item)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Code < items[j].Code
+	})
+
+	log.Printf("Time series (%s) for %d items built in %v", interval, len(items), time.Since(startTime))
+
+	return &TimeSeriesResponse{
+		Interval: interval,
+		Items:    items,
+		Total:    len(items),
+	}, nil
+}
+
+// bucketAvailability walks sorted events the same way calculateOSA does and
+// splits the in-stock hours across fixed-size buckets starting at startDate.
+func bucketAvailability(events []StockEvent, startDate, finishDate time.Time, step time.Duration, buckets int) []float64 {
+	avail := make([]float64, buckets)
+	if len(events) == 0 {
+		return avail
+	}
+
+	add := func(from, to time.Time) {
+		for from.Before(to) {
+			idx := int(from.Sub(startDate) / step)
+			if idx >= buckets {
+				return
+			}
+			bucketEnd := startDate.Add(time.Duration(idx+1) * step)
+			if bucketEnd.After(to) {
+				bucketEnd = to
+			}
+			avail[idx] += bucketEnd.Sub(from).Hours()
+			from = bucketEnd
+		}
+	}
+
+	balance := events[0].Start
+	current := startDate
+
+	for _, event := range events {
+		t := event.Time
+		if t.Before(startDate) {
+			balance = event.End
+			continue
+		}
+		if t.After(finishDate) {
+			break
+		}
+
+		if balance > 0 {
+			add(current, t)
+		}
+
+		balance = event.End
+		current = t
+	}
+
+	if current.Before(finishDate) && balance > 0 {
+		add(current, finishDate)
+	}
+
+	return avail
+}
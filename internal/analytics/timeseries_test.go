@@ -0,0 +1,174 @@
+package analytics
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func timeSeriesTestService() *Service {
+	return NewService(&MemoryDataSource{
+		Stock: []StockItem{
+			{НоменклатураКод: "1001", Номенклатура: "Товар 1", Родитель: "Группа 1", Период: "01.01.2024 00:00:00", НачальныйОстаток: 0, КонечныйОстаток: 10},
+			{НоменклатураКод: "1001", Номенклатура: "Товар 1", Родитель: "Группа 1", Период: "01.01.2024 12:00:00", НачальныйОстаток: 10, КонечныйОстаток: 0},
+			{НоменклатураКод: "1001", Номенклатура: "Товар 1", Родитель: "Группа 1", Период: "02.01.2024 06:00:00", НачальныйОстаток: 0, КонечныйОстаток: 5},
+			{НоменклатураКод: "1001", Номенклатура: "Товар 1", Родитель: "Группа 1", Период: "03.01.2024 06:00:00", НачальныйОстаток: 5, КонечныйОстаток: 3, СтатьяРасходов: "Порча на складах (94)"},
+			{НоменклатураКод: "1002", Номенклатура: "Товар 2", Родитель: "Группа 2", Период: "01.01.2024 00:00:00", НачальныйОстаток: 0, КонечныйОстаток: 1},
+		},
+		Sales: []SalesItem{
+			{Код: "1001", Номенклатура: "Товар 1", Период: "01.01.2024 10:00:00", Количество: 2, Сумма: 200},
+			{Код: "1001", Номенклатура: "Товар 1", Период: "03.01.2024 10:00:00", Количество: 1, Сумма: 100},
+			{Код: "1003", Номенклатура: "Товар 3", Период: "02.01.2024 10:00:00", Количество: 1, Сумма: 50},
+			{Код: "1003", Номенклатура: "Товар 3", Количество: 1, Сумма: 999},
+		},
+	})
+}
+
+func TestService_GetTimeSeries_Daily(t *testing.T) {
+	service := timeSeriesTestService()
+
+	response, err := service.GetTimeSeries(&TimeSeriesRequest{
+		StartDate:  "01.01.2024",
+		FinishDate: "03.01.2024",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if response.Interval != "day" {
+		t.Fatalf("Expected default interval day, got %s", response.Interval)
+	}
+
+	if response.Total != 3 {
+		t.Fatalf("Expected 3 items, got %d", response.Total)
+	}
+
+	item := response.Items[0]
+	if item.Code != "1001" || item.Group != "Группа 1" || item.Name != "Товар 1" {
+		t.Fatalf("Unexpected first item: %+v", item)
+	}
+
+	if len(item.Points) != 3 {
+		t.Fatalf("Expected 3 daily points, got %d", len(item.Points))
+	}
+
+	expected := []TimeSeriesPoint{
+		{Period: "01.01.2024", OSA: 50, Sales: 200, Quantity: 2},
+		{Period: "02.01.2024", OSA: 75},
+		{Period: "03.01.2024", OSA: 100, Sales: 100, Quantity: 1, LossQuantity: 2},
+	}
+	for i, want := range expected {
+		if item.Points[i] != want {
+			t.Fatalf("Point %d: expected %+v, got %+v", i, want, item.Points[i])
+		}
+	}
+
+	if response.Items[2].Points[1].Sales != 50 || response.Items[2].Points[1].OSA != 0 {
+		t.Fatalf("Expected item without stock to report sales and zero OSA, got %+v", response.Items[2].Points[1])
+	}
+}
+
+func TestService_GetTimeSeries_MatchesAggregateOSA(t *testing.T) {
+	service := timeSeriesTestService()
+
+	series, err := service.GetTimeSeries(&TimeSeriesRequest{
+		StartDate:  "01.01.2024",
+		FinishDate: "03.01.2024",
+		Interval:   "hour",
+		Codes:      []string{"1001"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if series.Total != 1 || len(series.Items[0].Points) != 72 {
+		t.Fatalf("Expected 1 item with 72 hourly points, got %d items", series.Total)
+	}
+
+	sum := 0.0
+	for _, point := range series.Items[0].Points {
+		sum += point.OSA
+	}
+
+	aggregate, err := service.GetItemAnalytics(&ItemAnalyticsRequest{
+		StartDate:  "01.01.2024",
+		FinishDate: "03.01.2024",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for _, item := range aggregate.Items {
+		if item.Code == "1001" && math.Abs(sum/72-item.OSA) > 0.01 {
+			t.Fatalf("Expected mean hourly OSA %f to match aggregate OSA %f", sum/72, item.OSA)
+		}
+	}
+}
+
+func TestService_GetTimeSeries_CarriedBalance(t *testing.T) {
+	service := NewService(&MemoryDataSource{
+		Stock: []StockItem{
+			{НоменклатураКод: "1001", Номенклатура: "Товар 1", Период: "30.12.2023 10:00:00", НачальныйОстаток: 0, КонечныйОстаток: 10},
+		},
+		Sales: []SalesItem{
+			{Код: "1001", Номенклатура: "Товар 1", Период: "02.01.2024 10:00:00", Количество: 1, Сумма: 100},
+		},
+	})
+
+	series, err := service.GetTimeSeries(&TimeSeriesRequest{StartDate: "01.01.2024", FinishDate: "03.01.2024"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if series.Total != 1 {
+		t.Fatalf("Expected 1 item, got %d", series.Total)
+	}
+	for _, point := range series.Items[0].Points {
+		if point.OSA != 100 {
+			t.Fatalf("Expected the balance from before the window to keep the item in stock, got %+v", point)
+		}
+	}
+
+	aggregate, err := service.GetItemAnalytics(&ItemAnalyticsRequest{StartDate: "01.01.2024", FinishDate: "03.01.2024"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if aggregate.Items[0].OSA != 100 {
+		t.Fatalf("Expected aggregate OSA 100, got %v", aggregate.Items[0].OSA)
+	}
+}
+
+func TestService_GetTimeSeries_InvalidRequest(t *testing.T) {
+	service := timeSeriesTestService()
+
+	testCases := []TimeSeriesRequest{
+		{StartDate: "01.01.2024", FinishDate: "31.01.2024", Interval: "week"},
+		{StartDate: "01.01.2024", FinishDate: "31.03.2024", Interval: "hour"},
+		{StartDate: "01.01.1925", FinishDate: "01.01.2025", Interval: "day"},
+		{StartDate: "10.01.2024", FinishDate: "01.01.2024"},
+		{StartDate: "invalid", FinishDate: "01.01.2024"},
+	}
+
+	for _, tc := range testCases {
+		_, err := service.GetTimeSeries(&tc)
+		var validationErr *ValidationError
+		if !errors.As(err, &validationErr) {
+			t.Fatalf("Expected validation error for %+v, got %v", tc, err)
+		}
+	}
+}
+
+func TestBucketAvailability(t *testing.T) {
+	startDate := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	finishDate := startDate.Add(48 * time.Hour)
+
+	events := []StockEvent{
+		{Time: startDate.Add(-time.Hour), Start: 0, End: 3},
+		{Time: startDate.Add(30 * time.Hour), Start: 3, End: 0},
+	}
+
+	avail := bucketAvailability(events, startDate, finishDate, 24*time.Hour, 2)
+	if avail[0] != 24 || avail[1] != 6 {
+		t.Fatalf("Expected [24 6] available hours, got %v", avail)
+	}
+}
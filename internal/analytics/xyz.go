@@ -0,0 +1,152 @@
+package analytics
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	defaultXThreshold = 0.1
+	defaultYThreshold = 0.25
+)
+
+func resolveXYZOptions(opts *XYZOptions) (time.Duration, float64, float64, error) {
+	period := "day"
+	x, y := defaultXThreshold, defaultYThreshold
+	if opts != nil {
+		if opts.Period != "" {
+			period = opts.Period
+		}
+		if opts.XThreshold != 0 {
+			x = opts.XThreshold
+		}
+		if opts.YThreshold != 0 {
+			y = opts.YThreshold
+		}
+	}
+
+	var step time.Duration
+	switch period {
+	case "day":
+		step = 24 * time.Hour
+	case "week":
+		step = 7 * 24 * time.Hour
+	default:
+		return 0, 0, 0, &ValidationError{Message: fmt.Sprintf("XYZ.Period must be day or week, got %q", period)}
+	}
+
+	if x <= 0 || y <= 0 {
+		return 0, 0, 0, &ValidationError{Message: "XYZ thresholds must be positive"}
+	}
+	if x >= y {
+		return 0, 0, 0, &ValidationError{Message: fmt.Sprintf("XYZ.XThreshold (%g) must be less than XYZ.YThreshold (%g)", x, y)}
+	}
+
+	return step, x, y, nil
+}
+
+// calculateXYZClassification assigns X/Y/Z from the coefficient of variation
+// of per-period sales. Periods without sales count as zero demand; undated
+// sales rows cannot be placed in a period and are ignored here. Only periods
+// with sales are stored, so a long window costs no more than a short one.
+func (s *Service) calculateXYZClassification(items []ItemAnalyticsResult, salesData []SalesItem, startDate, finishDate time.Time, step time.Duration, xThreshold, yThreshold float64) {
+	if len(items) == 0 {
+		return
+	}
+
+	periods := int((finishDate.Sub(startDate) + step - 1) / step)
+	if periods <= 0 {
+		return
+	}
+
+	demand := make(map[string]map[int]float64, len(items))
+	for i := range items {
+		demand[items[i].Code] = nil
+	}
+
+	for _, sale := range salesData {
+		code := strings.TrimSpace(sale.Код)
+		series, ok := demand[code]
+		if !ok {
+			continue
+		}
+
+		dt := parsePeriod(sale.Период)
+		if dt == nil || dt.Before(startDate) || !dt.Before(finishDate) {
+			continue
+		}
+
+		if series == nil {
+			series = make(map[int]float64)
+			demand[code] = series
+		}
+		series[int(dt.Sub(startDate)/step)] += sale.Сумма
+	}
+
+	for i := range items {
+		series := demand[items[i].Code]
+		if series == nil {
+			continue
+		}
+
+		cv := coefficientOfVariation(series, periods)
+		switch {
+		case cv <= xThreshold:
+			items[i].XYZ = "X"
+		case cv <= yThreshold:
+			items[i].XYZ = "Y"
+		default:
+			items[i].XYZ = "Z"
+		}
+	}
+}
+
+// coefficientOfVariation is taken over periods values, of which the ones
+// missing from sums are zero.
+func coefficientOfVariation(sums map[int]float64, periods int) float64 {
+	mean := 0.0
+	for _, v := range sums {
+		mean += v
+	}
+	mean /= float64(periods)
+	if mean == 0 {
+		return math.Inf(1)
+	}
+
+	variance := float64(periods-len(sums)) * mean * mean
+	for _, v := range sums {
+		variance += (v - mean) * (v - mean)
+	}
+	variance /= float64(periods)
+
+	return math.Sqrt(variance) / mean
+}
+
+func buildABCXYZMatrix(items []ItemAnalyticsResult) map[string]MatrixCell {
+	matrix := make(map[string]MatrixCell, 9)
+	for _, abc := range []string{"A", "B", "C"} {
+		for _, xyz := range []string{"X", "Y", "Z"} {
+			matrix[abc+xyz] = MatrixCell{}
+		}
+	}
+
+	for _, item := range items {
+		if item.ABC == "" || item.XYZ == "" {
+			continue
+		}
+		key := item.ABC + item.XYZ
+		cell := matrix[key]
+		cell.Items++
+		cell.Sales += item.Sales
+		matrix[key] = cell
+	}
+
+	for key, cell := range matrix {
+		cell.Sales = math.Round(cell.Sales*100) / 100
+		matrix[key] = cell
+	}
+
+	return matrix
+}
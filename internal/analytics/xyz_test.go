@@ -0,0 +1,130 @@
+package analytics
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCoefficientOfVariation(t *testing.T) {
+	if cv := coefficientOfVariation(map[int]float64{0: 10, 1: 10, 2: 10}, 3); cv != 0 {
+		t.Fatalf("Expected CV 0 for flat demand, got %f", cv)
+	}
+
+	if cv := coefficientOfVariation(map[int]float64{1: 20}, 2); math.Abs(cv-1) > 1e-9 {
+		t.Fatalf("Expected CV 1, got %f", cv)
+	}
+
+	if cv := coefficientOfVariation(map[int]float64{}, 2); !math.IsInf(cv, 1) {
+		t.Fatalf("Expected infinite CV for zero demand, got %f", cv)
+	}
+}
+
+func TestService_calculateXYZClassification(t *testing.T) {
+	service := NewService(&MemoryDataSource{})
+
+	startDate := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	finishDate := startDate.Add(4 * 24 * time.Hour)
+
+	items := []ItemAnalyticsResult{{Code: "X1"}, {Code: "Y1"}, {Code: "Z1"}, {Code: "U1"}}
+	salesData := []SalesItem{
+		{Код: "X1", Период: "01.01.2024", Сумма: 100},
+		{Код: "X1", Период: "02.01.2024", Сумма: 100},
+		{Код: "X1", Период: "03.01.2024", Сумма: 100},
+		{Код: "X1", Период: "04.01.2024", Сумма: 100},
+		{Код: "Y1", Период: "01.01.2024", Сумма: 80},
+		{Код: "Y1", Период: "02.01.2024", Сумма: 120},
+		{Код: "Y1", Период: "03.01.2024", Сумма: 80},
+		{Код: "Y1", Период: "04.01.2024", Сумма: 120},
+		{Код: "Z1", Период: "01.01.2024", Сумма: 400},
+		{Код: "U1", Сумма: 400},
+	}
+
+	service.calculateXYZClassification(items, salesData, startDate, finishDate, 24*time.Hour, defaultXThreshold, defaultYThreshold)
+
+	expected := map[string]string{"X1": "X", "Y1": "Y", "Z1": "Z", "U1": ""}
+	for _, item := range items {
+		if item.XYZ != expected[item.Code] {
+			t.Fatalf("Item %s: expected XYZ %q, got %q", item.Code, expected[item.Code], item.XYZ)
+		}
+	}
+}
+
+func TestService_calculateXYZClassification_LongWindow(t *testing.T) {
+	service := NewService(&MemoryDataSource{})
+
+	startDate := time.Date(1925, 1, 1, 0, 0, 0, 0, time.UTC)
+	finishDate := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	items := make([]ItemAnalyticsResult, 2000)
+	salesData := make([]SalesItem, 0, len(items))
+	for i := range items {
+		items[i].Code = fmt.Sprintf("%d", 1000+i)
+		salesData = append(salesData, SalesItem{Код: items[i].Code, Период: "01.06.2024", Сумма: 100})
+	}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	service.calculateXYZClassification(items, salesData, startDate, finishDate, 24*time.Hour, defaultXThreshold, defaultYThreshold)
+	runtime.ReadMemStats(&after)
+
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 16<<20 {
+		t.Fatalf("Expected memory to follow the sales rather than the window, allocated %d bytes", allocated)
+	}
+
+	// One sale in 36525 days: the CV is sqrt(periods-1).
+	for _, item := range items {
+		if item.XYZ != "Z" {
+			t.Fatalf("Item %s: expected XYZ Z, got %q", item.Code, item.XYZ)
+		}
+	}
+}
+
+func TestResolveXYZOptions(t *testing.T) {
+	step, x, y, err := resolveXYZOptions(nil)
+	if err != nil || step != 24*time.Hour || x != defaultXThreshold || y != defaultYThreshold {
+		t.Fatalf("Unexpected defaults: %v %f %f %v", step, x, y, err)
+	}
+
+	step, _, _, err = resolveXYZOptions(&XYZOptions{Period: "week"})
+	if err != nil || step != 7*24*time.Hour {
+		t.Fatalf("Expected weekly step, got %v %v", step, err)
+	}
+
+	invalid := []XYZOptions{
+		{Period: "month"},
+		{XThreshold: 0.5, YThreshold: 0.3},
+		{XThreshold: -0.1},
+	}
+	for _, opts := range invalid {
+		var validationErr *ValidationError
+		if _, _, _, err := resolveXYZOptions(&opts); !errors.As(err, &validationErr) {
+			t.Fatalf("Expected validation error for %+v, got %v", opts, err)
+		}
+	}
+}
+
+func TestBuildABCXYZMatrix(t *testing.T) {
+	matrix := buildABCXYZMatrix([]ItemAnalyticsResult{
+		{ABC: "A", XYZ: "X", Sales: 100},
+		{ABC: "A", XYZ: "X", Sales: 50.5},
+		{ABC: "C", XYZ: "Z", Sales: 1},
+		{ABC: "B", Sales: 10},
+	})
+
+	if len(matrix) != 9 {
+		t.Fatalf("Expected 9 matrix cells, got %d", len(matrix))
+	}
+
+	if matrix["AX"].Items != 2 || matrix["AX"].Sales != 150.5 {
+		t.Fatalf("Unexpected AX cell: %+v", matrix["AX"])
+	}
+
+	if matrix["CZ"].Items != 1 || matrix["BY"].Items != 0 {
+		t.Fatalf("Unexpected matrix: %+v", matrix)
+	}
+}
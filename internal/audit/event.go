@@ -0,0 +1,117 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Event types.
+const (
+	TokenIssued   = "token.issued"
+	TokenRejected = "token.rejected"
+	TokenRevoked  = "token.revoked"
+	LoginFailed   = "login.failed"
+	AccessDenied  = "access.denied"
+	APIKeyCreated = "api_key.created"
+	APIKeyRevoked = "api_key.revoked"
+	Analytics     = "analytics"
+)
+
+const (
+	defaultQueryLimit = 100
+	maxQueryLimit     = 1000
+
+	// reportDateLayout is the StartDate/FinishDate format of analytics
+	// requests.
+	reportDateLayout = "02.01.2006"
+)
+
+// Event is one audit line. Principal is the human-readable caller; UserID,
+// APIKeyID and Tenant repeat it in queryable form. StartDate, FinishDate,
+// Filters and Results describe analytics requests.
+type Event struct {
+	Time       time.Time       `json:"time"`
+	Type       string          `json:"type"`
+	Principal  string          `json:"principal,omitempty"`
+	UserID     int             `json:"user_id,omitempty"`
+	APIKeyID   string          `json:"api_key_id,omitempty"`
+	Email      string          `json:"email,omitempty"`
+	Tenant     string          `json:"tenant,omitempty"`
+	IP         string          `json:"ip,omitempty"`
+	Method     string          `json:"method,omitempty"`
+	Path       string          `json:"path,omitempty"`
+	Status     int             `json:"status,omitempty"`
+	StartDate  string          `json:"start_date,omitempty"`
+	FinishDate string          `json:"finish_date,omitempty"`
+	Filters    json.RawMessage `json:"filters,omitempty"`
+	Results    *int            `json:"results,omitempty"`
+	DurationMS float64         `json:"duration_ms,omitempty"`
+	Detail     string          `json:"detail,omitempty"`
+}
+
+// Query selects events. Zero fields match everything; Covers is a report
+// date (DD.MM.YYYY) that must fall within the event's StartDate..FinishDate.
+type Query struct {
+	Type     string
+	UserID   int
+	APIKeyID string
+	Tenant   string
+	From     time.Time
+	To       time.Time
+	Covers   time.Time
+	Limit    int
+}
+
+func (q *Query) limit() int {
+	if q.Limit <= 0 {
+		return defaultQueryLimit
+	}
+	if q.Limit > maxQueryLimit {
+		return maxQueryLimit
+	}
+	return q.Limit
+}
+
+func (q *Query) Matches(event Event) bool {
+	switch {
+	case q.Type != "" && event.Type != q.Type,
+		q.UserID != 0 && event.UserID != q.UserID,
+		q.APIKeyID != "" && event.APIKeyID != q.APIKeyID,
+		q.Tenant != "" && event.Tenant != q.Tenant,
+		!q.From.IsZero() && event.Time.Before(q.From),
+		!q.To.IsZero() && !event.Time.Before(q.To):
+		return false
+	}
+
+	if q.Covers.IsZero() {
+		return true
+	}
+	start, err := time.Parse(reportDateLayout, event.StartDate)
+	if err != nil {
+		return false
+	}
+	finish, err := time.Parse(reportDateLayout, event.FinishDate)
+	if err != nil {
+		return false
+	}
+	return !q.Covers.Before(start) && !q.Covers.After(finish)
+}
+
+// ParseReportDate parses a date in the format analytics requests use.
+func ParseReportDate(value string) (time.Time, error) {
+	return time.Parse(reportDateLayout, value)
+}
+
+type eventKey struct{}
+
+// WithEvent attaches an event that handlers further down fill in before it
+// is recorded.
+func WithEvent(ctx context.Context, event *Event) context.Context {
+	return context.WithValue(ctx, eventKey{}, event)
+}
+
+func EventFromContext(ctx context.Context) (*Event, bool) {
+	event, ok := ctx.Value(eventKey{}).(*Event)
+	return event, ok
+}
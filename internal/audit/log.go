@@ -0,0 +1,306 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxSize  = 100 << 20
+	defaultMaxFiles = 10
+
+	// memoryEvents bounds a log that is not backed by a file.
+	memoryEvents = 10000
+)
+
+// Log is an append-only audit trail. A log opened from a file writes one
+// JSON line per event and rotates the file to path.1, path.2, ... once it
+// reaches maxSize, keeping maxFiles rotated files. A log from NewLog keeps
+// the latest events in memory only.
+type Log struct {
+	path     string
+	file     *os.File
+	size     int64
+	maxSize  int64
+	maxFiles int
+	events   *ring
+	closed   bool
+	mu       sync.Mutex
+	now      func() time.Time
+}
+
+func NewLog() *Log {
+	return &Log{events: newRing(memoryEvents), now: time.Now}
+}
+
+// OpenLog opens path for appending, creating it if needed. Sizes that are
+// not positive fall back to 100 MiB and 10 files.
+func OpenLog(path string, maxSize int64, maxFiles int) (*Log, error) {
+	l := &Log{
+		path:     path,
+		maxSize:  defaultMaxSize,
+		maxFiles: defaultMaxFiles,
+		now:      time.Now,
+	}
+	if maxSize > 0 {
+		l.maxSize = maxSize
+	}
+	if maxFiles > 0 {
+		l.maxFiles = maxFiles
+	}
+
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Log) open() error {
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	l.file = file
+	l.size = info.Size()
+	return nil
+}
+
+// Record appends event, stamping its time if it has none. Audit failures are
+// logged rather than returned: losing an audit line must not fail the
+// request it describes.
+func (l *Log) Record(event Event) {
+	if event.Time.IsZero() {
+		event.Time = l.now().UTC()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return
+	}
+
+	if l.path == "" {
+		l.events.add(event)
+		return
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to encode audit event: %v", err)
+		return
+	}
+	line = append(line, '\n')
+
+	if l.file != nil && l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			log.Printf("Failed to rotate audit log: %v", err)
+		}
+	}
+	// A failed rotation leaves no file open; keep appending to path rather
+	// than losing events.
+	if l.file == nil {
+		if err := l.open(); err != nil {
+			log.Printf("Dropped audit event %s: %v", event.Type, err)
+			return
+		}
+	}
+
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		log.Printf("Failed to write audit event: %v", err)
+	}
+}
+
+// rotate shifts path.N-1 to path.N, drops the oldest file and starts a new
+// one. The caller must hold the lock.
+func (l *Log) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	l.file = nil
+
+	os.Remove(l.rotated(l.maxFiles))
+	for i := l.maxFiles - 1; i >= 1; i-- {
+		if err := os.Rename(l.rotated(i), l.rotated(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(l.path, l.rotated(1)); err != nil {
+		return err
+	}
+
+	return l.open()
+}
+
+func (l *Log) rotated(i int) string {
+	return fmt.Sprintf("%s.%d", l.path, i)
+}
+
+// Query returns the events matching q, newest first. File logs are read
+// from disk, oldest rotated file first, so the result covers everything
+// still retained. The files are opened under the lock and read without it,
+// so a long query never holds up Record; rotation only renames files that
+// are already open.
+func (l *Log) Query(q Query) ([]Event, error) {
+	matched := newRing(q.limit())
+	keep := func(event Event) {
+		if q.Matches(event) {
+			matched.add(event)
+		}
+	}
+
+	if l.path == "" {
+		l.mu.Lock()
+		l.events.each(keep)
+		l.mu.Unlock()
+		return matched.newestFirst(), nil
+	}
+
+	files, err := l.openFiles()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+
+	for _, file := range files {
+		if err := scanFile(file, keep); err != nil {
+			return nil, err
+		}
+	}
+	return matched.newestFirst(), nil
+}
+
+// snapshotFile is a retained file as of the query: the current file is read
+// only up to what was written when it was opened, never a half-written line.
+type snapshotFile struct {
+	*os.File
+	size int64
+}
+
+// openFiles opens every retained file, oldest first.
+func (l *Log) openFiles() ([]snapshotFile, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var files []snapshotFile
+	for i := l.maxFiles; i >= 0; i-- {
+		path := l.path
+		if i > 0 {
+			path = l.rotated(i)
+		}
+
+		file, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			for _, opened := range files {
+				opened.Close()
+			}
+			return nil, fmt.Errorf("failed to read audit log: %w", err)
+		}
+
+		size := int64(-1)
+		if i == 0 {
+			size = l.size
+		}
+		files = append(files, snapshotFile{File: file, size: size})
+	}
+	return files, nil
+}
+
+func scanFile(file snapshotFile, keep func(Event)) error {
+	var r io.Reader = file
+	if file.size >= 0 {
+		r = io.LimitReader(file, file.size)
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			log.Printf("Warning: skipping malformed audit event at %s:%d: %v", file.Name(), line, err)
+			continue
+		}
+		keep(event)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return nil
+}
+
+// ring keeps the last events added to it, up to its capacity.
+type ring struct {
+	events []Event
+	size   int
+	next   int
+}
+
+func newRing(size int) *ring {
+	return &ring{size: size}
+}
+
+func (r *ring) add(event Event) {
+	if len(r.events) < r.size {
+		r.events = append(r.events, event)
+		return
+	}
+	r.events[r.next] = event
+	r.next = (r.next + 1) % len(r.events)
+}
+
+// each calls fn for every event, oldest first.
+func (r *ring) each(fn func(Event)) {
+	for i := range r.events {
+		fn(r.events[(r.next+i)%len(r.events)])
+	}
+}
+
+func (r *ring) newestFirst() []Event {
+	events := make([]Event, 0, len(r.events))
+	for i := len(r.events) - 1; i >= 0; i-- {
+		events = append(events, r.events[(r.next+i)%len(r.events)])
+	}
+	return events
+}
+
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.closed = true
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
@@ -0,0 +1,166 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLog_RecordAndQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLog, err := OpenLog(path, 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer auditLog.Close()
+
+	base := time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC)
+	results := 12
+	events := []Event{
+		{Time: base, Type: TokenIssued, UserID: 1, Tenant: "client-a"},
+		{Time: base.Add(time.Minute), Type: Analytics, UserID: 1, Tenant: "client-a", StartDate: "01.01.2024", FinishDate: "31.01.2024", Results: &results},
+		{Time: base.Add(2 * time.Minute), Type: Analytics, UserID: 2, Tenant: "client-b", StartDate: "01.01.2024", FinishDate: "31.01.2024"},
+		{Time: base.Add(3 * time.Minute), Type: Analytics, UserID: 1, Tenant: "client-a", StartDate: "01.02.2024", FinishDate: "29.02.2024"},
+	}
+	for _, event := range events {
+		auditLog.Record(event)
+	}
+
+	reopened, err := OpenLog(path, 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to reopen audit log: %v", err)
+	}
+	defer reopened.Close()
+
+	testCases := []struct {
+		name     string
+		query    Query
+		expected []time.Time
+	}{
+		{"everything, newest first", Query{}, []time.Time{events[3].Time, events[2].Time, events[1].Time, events[0].Time}},
+		{"January report of client-a", Query{Type: Analytics, Tenant: "client-a", Covers: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)}, []time.Time{events[1].Time}},
+		{"by user", Query{UserID: 2}, []time.Time{events[2].Time}},
+		{"time window", Query{From: events[1].Time, To: events[3].Time}, []time.Time{events[2].Time, events[1].Time}},
+		{"limit", Query{Limit: 1}, []time.Time{events[3].Time}},
+	}
+
+	for _, tc := range testCases {
+		matched, err := reopened.Query(tc.query)
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", tc.name, err)
+		}
+		if len(matched) != len(tc.expected) {
+			t.Fatalf("%s: expected %d events, got %+v", tc.name, len(tc.expected), matched)
+		}
+		for i, event := range matched {
+			if !event.Time.Equal(tc.expected[i]) {
+				t.Fatalf("%s: expected event %d at %s, got %s", tc.name, i, tc.expected[i], event.Time)
+			}
+		}
+	}
+
+	matched, _ := reopened.Query(Query{Type: Analytics, Tenant: "client-a", Limit: 1, Covers: time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)})
+	if len(matched) != 1 || matched[0].Results == nil || *matched[0].Results != 12 {
+		t.Fatalf("Expected the result count to survive the round trip, got %+v", matched)
+	}
+}
+
+func TestLog_Rotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLog, err := OpenLog(path, 200, 2)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer auditLog.Close()
+
+	base := time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < 20; i++ {
+		auditLog.Record(Event{Time: base.Add(time.Duration(i) * time.Minute), Type: Analytics, UserID: i + 1})
+	}
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatalf("Expected %s to exist: %v", name, err)
+		}
+		if info.Size() > 200 {
+			t.Fatalf("Expected %s to stay within the size limit, got %d bytes", name, info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("Expected at most 2 rotated files, got %v", err)
+	}
+
+	matched, err := auditLog.Query(Query{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(matched) == 0 || matched[0].UserID != 20 {
+		t.Fatalf("Expected the newest event first, got %+v", matched)
+	}
+	for i := 1; i < len(matched); i++ {
+		if !matched[i].Time.Before(matched[i-1].Time) {
+			t.Fatalf("Expected events across rotated files in order, got %+v", matched)
+		}
+	}
+}
+
+func TestLog_Memory_KeepsNewest(t *testing.T) {
+	auditLog := NewLog()
+
+	base := time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < memoryEvents+5; i++ {
+		auditLog.Record(Event{Time: base.Add(time.Duration(i) * time.Second), Type: Analytics, UserID: i%2 + 1})
+	}
+
+	matched, err := auditLog.Query(Query{UserID: 1, Limit: 3})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	last := base.Add(time.Duration(memoryEvents+4) * time.Second)
+	if len(matched) != 3 || !matched[0].Time.Equal(last) || !matched[2].Time.Equal(last.Add(-4*time.Second)) {
+		t.Fatalf("Expected the 3 newest events of user 1, got %+v", matched)
+	}
+
+	matched, _ = auditLog.Query(Query{Limit: maxQueryLimit})
+	if len(matched) != maxQueryLimit || !matched[maxQueryLimit-1].Time.Equal(last.Add(-(maxQueryLimit-1)*time.Second)) {
+		t.Fatalf("Expected the %d newest events in order, got %d", maxQueryLimit, len(matched))
+	}
+}
+
+func TestLog_QueryWhileRotating(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLog, err := OpenLog(path, 500, 3)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer auditLog.Close()
+
+	base := time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 500; i++ {
+			auditLog.Record(Event{Time: base.Add(time.Duration(i) * time.Second), Type: Analytics, UserID: i + 1})
+		}
+	}()
+
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+
+		matched, err := auditLog.Query(Query{})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		for i := 1; i < len(matched); i++ {
+			if !matched[i].Time.Before(matched[i-1].Time) {
+				t.Fatalf("Expected events newest first, got %s after %s", matched[i].Time, matched[i-1].Time)
+			}
+		}
+	}
+}
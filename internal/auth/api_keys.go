@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"strings"
+	"time"
+
+	"analytics-service/internal/userdb"
+)
+
+// APIKeyPrefix starts every API key so the middleware can tell keys from
+// user tokens.
+const APIKeyPrefix = "ak_"
+
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+type CreateAPIKeyRequest struct {
+	Name       string       `json:"name"`
+	Scopes     []Permission `json:"scopes"`
+	Tenant     string       `json:"tenant,omitempty"`
+	AllowedIPs []string     `json:"allowed_ips,omitempty"`
+	ExpiresAt  *time.Time   `json:"expires_at,omitempty"`
+}
+
+// APIKeyInfo describes a key without its secret.
+type APIKeyInfo struct {
+	ID         string       `json:"id"`
+	Name       string       `json:"name"`
+	Tenant     string       `json:"tenant,omitempty"`
+	Scopes     []Permission `json:"scopes"`
+	AllowedIPs []string     `json:"allowed_ips,omitempty"`
+	CreatedBy  int          `json:"created_by"`
+	CreatedAt  time.Time    `json:"created_at"`
+	ExpiresAt  *time.Time   `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time   `json:"last_used_at,omitempty"`
+	Revoked    bool         `json:"revoked,omitempty"`
+}
+
+// CreateAPIKeyResponse is the only place the key itself is ever shown.
+type CreateAPIKeyResponse struct {
+	Key string `json:"key"`
+	APIKeyInfo
+}
+
+func (s *Service) SetAPIKeyStore(keys *userdb.APIKeyStore) {
+	if keys != nil {
+		s.apiKeys = keys
+	}
+}
+
+// CreateAPIKey issues a key on behalf of creator. Keys read the creator's
+// tenant unless another one is named.
+func (s *Service) CreateAPIKey(req *CreateAPIKeyRequest, creator *Principal) (*CreateAPIKeyResponse, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidAPIKey)
+	}
+
+	if len(req.Scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidAPIKey)
+	}
+	scopes := make([]string, 0, len(req.Scopes))
+	for _, scope := range req.Scopes {
+		if !knownPermission(scope) {
+			return nil, fmt.Errorf("%w: unknown scope %q", ErrInvalidAPIKey, scope)
+		}
+		scopes = append(scopes, string(scope))
+	}
+
+	for _, entry := range req.AllowedIPs {
+		if _, err := parseIPRange(entry); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidAPIKey, err)
+		}
+	}
+
+	now := s.now()
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		return nil, fmt.Errorf("%w: expires_at must be in the future", ErrInvalidAPIKey)
+	}
+
+	id, err := newTokenID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create api key: %w", err)
+	}
+	secret, err := newTokenID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	tenant := req.Tenant
+	if tenant == "" {
+		tenant = creator.Tenant
+	}
+
+	key := userdb.APIKey{
+		ID:         id[:12],
+		Name:       name,
+		Hash:       apiKeyHash(APIKeyPrefix + secret),
+		Tenant:     tenant,
+		Scopes:     scopes,
+		AllowedIPs: req.AllowedIPs,
+		CreatedBy:  creator.UserID,
+		CreatedAt:  now,
+	}
+	if req.ExpiresAt != nil {
+		key.ExpiresAt = *req.ExpiresAt
+	}
+
+	if err := s.apiKeys.Create(key); err != nil {
+		return nil, fmt.Errorf("failed to store api key: %w", err)
+	}
+
+	return &CreateAPIKeyResponse{Key: APIKeyPrefix + secret, APIKeyInfo: apiKeyInfo(key)}, nil
+}
+
+func (s *Service) ListAPIKeys() []APIKeyInfo {
+	keys := s.apiKeys.List()
+	infos := make([]APIKeyInfo, 0, len(keys))
+	for _, key := range keys {
+		infos = append(infos, apiKeyInfo(key))
+	}
+	return infos
+}
+
+func (s *Service) RevokeAPIKey(id string) error {
+	return s.apiKeys.Revoke(id)
+}
+
+// AuthenticateAPIKey returns the principal of an active key presented from
+// remoteIP. The principal's permissions are the key's scopes, not a role.
+func (s *Service) AuthenticateAPIKey(apiKey, remoteIP string) (*Principal, bool) {
+	if !strings.HasPrefix(apiKey, APIKeyPrefix) {
+		return nil, false
+	}
+
+	key, exists := s.apiKeys.Lookup(apiKeyHash(apiKey))
+	now := s.now()
+	if !exists || key.Revoked || key.Expired(now) {
+		return nil, false
+	}
+
+	if !ipAllowed(key.AllowedIPs, remoteIP) {
+		log.Printf("API key %s (%s) used from %s outside its allowlist", key.ID, key.Name, remoteIP)
+		return nil, false
+	}
+
+	if err := s.apiKeys.Touch(key.ID, now); err != nil {
+		log.Printf("Failed to record use of API key %s: %v", key.ID, err)
+	}
+
+	scopes := make([]Permission, 0, len(key.Scopes))
+	for _, scope := range key.Scopes {
+		scopes = append(scopes, Permission(scope))
+	}
+
+	return &Principal{Tenant: key.Tenant, APIKeyID: key.ID, Scopes: scopes}, true
+}
+
+func apiKeyInfo(key userdb.APIKey) APIKeyInfo {
+	info := APIKeyInfo{
+		ID:         key.ID,
+		Name:       key.Name,
+		Tenant:     key.Tenant,
+		AllowedIPs: key.AllowedIPs,
+		CreatedBy:  key.CreatedBy,
+		CreatedAt:  key.CreatedAt,
+		Revoked:    key.Revoked,
+	}
+	for _, scope := range key.Scopes {
+		info.Scopes = append(info.Scopes, Permission(scope))
+	}
+	if !key.ExpiresAt.IsZero() {
+		info.ExpiresAt = &key.ExpiresAt
+	}
+	if !key.LastUsedAt.IsZero() {
+		info.LastUsedAt = &key.LastUsedAt
+	}
+	return info
+}
+
+// apiKeyHash is a plain SHA-256: keys carry 128 random bits, so unlike
+// passwords they need no slow hash.
+func apiKeyHash(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])
+}
+
+func parseIPRange(entry string) (netip.Prefix, error) {
+	if strings.Contains(entry, "/") {
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid allowed_ips entry %q", entry)
+		}
+		return prefix.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid allowed_ips entry %q", entry)
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+func ipAllowed(allowed []string, remoteIP string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	addr, err := netip.ParseAddr(remoteIP)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, entry := range allowed {
+		if prefix, err := parseIPRange(entry); err == nil && prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"analytics-service/internal/userdb"
+)
+
+func TestService_CreateAPIKey(t *testing.T) {
+	service := NewService("test-secret", userdb.NewTokenStore())
+	admin := &Principal{UserID: 9, Tenant: "client-a", Role: userdb.RoleAdmin}
+
+	response, err := service.CreateAPIKey(&CreateAPIKeyRequest{Name: "etl", Scopes: []Permission{PermReadAnalytics}}, admin)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if !strings.HasPrefix(response.Key, APIKeyPrefix) || response.ID == "" || response.Tenant != "client-a" || response.CreatedBy != 9 {
+		t.Fatalf("Unexpected key: %+v", response)
+	}
+
+	for _, key := range service.apiKeys.List() {
+		if strings.Contains(key.Hash, strings.TrimPrefix(response.Key, APIKeyPrefix)) {
+			t.Fatal("Expected the key to be stored hashed")
+		}
+	}
+
+	past := time.Now().Add(-time.Hour)
+	for _, req := range []*CreateAPIKeyRequest{
+		{Scopes: []Permission{PermReadAnalytics}},
+		{Name: "etl"},
+		{Name: "etl", Scopes: []Permission{"analytics:write"}},
+		{Name: "etl", Scopes: []Permission{PermReadAnalytics}, AllowedIPs: []string{"10.0.0.0/33"}},
+		{Name: "etl", Scopes: []Permission{PermReadAnalytics}, ExpiresAt: &past},
+	} {
+		if _, err := service.CreateAPIKey(req, admin); !errors.Is(err, ErrInvalidAPIKey) {
+			t.Fatalf("Expected ErrInvalidAPIKey for %+v, got %v", req, err)
+		}
+	}
+}
+
+func TestService_AuthenticateAPIKey(t *testing.T) {
+	service := NewService("test-secret", userdb.NewTokenStore())
+	admin := &Principal{UserID: 9, Tenant: userdb.DefaultTenant, Role: userdb.RoleAdmin}
+
+	issuedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return issuedAt }
+
+	expiresAt := issuedAt.Add(24 * time.Hour)
+	response, err := service.CreateAPIKey(&CreateAPIKeyRequest{
+		Name:       "bi",
+		Scopes:     []Permission{PermReadAnalytics},
+		AllowedIPs: []string{"10.1.0.0/16", "192.168.1.5"},
+		ExpiresAt:  &expiresAt,
+	}, admin)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	principal, ok := service.AuthenticateAPIKey(response.Key, "10.1.2.3")
+	if !ok || principal.APIKeyID != response.ID || principal.Tenant != userdb.DefaultTenant {
+		t.Fatalf("Expected key principal, got %+v", principal)
+	}
+
+	if !principal.Can(PermReadAnalytics) || principal.Can(PermExploreAnalytics) || principal.Can(PermAdmin) {
+		t.Fatal("Expected permissions to follow the key's scopes")
+	}
+
+	if info := service.ListAPIKeys()[0]; info.LastUsedAt == nil || !info.LastUsedAt.Equal(issuedAt) {
+		t.Fatalf("Expected last use to be recorded, got %+v", info.LastUsedAt)
+	}
+
+	if _, ok := service.AuthenticateAPIKey(response.Key, "::ffff:192.168.1.5"); !ok {
+		t.Fatal("Expected an IPv4-mapped address on the allowlist to pass")
+	}
+
+	for _, ip := range []string{"10.2.0.1", "not-an-ip"} {
+		if _, ok := service.AuthenticateAPIKey(response.Key, ip); ok {
+			t.Fatalf("Expected %s to be refused", ip)
+		}
+	}
+
+	if _, ok := service.AuthenticateAPIKey(response.Key+"x", "10.1.2.3"); ok {
+		t.Fatal("Expected an unknown key to be refused")
+	}
+
+	service.now = func() time.Time { return expiresAt }
+	if _, ok := service.AuthenticateAPIKey(response.Key, "10.1.2.3"); ok {
+		t.Fatal("Expected an expired key to be refused")
+	}
+
+	service.now = func() time.Time { return issuedAt }
+	if err := service.RevokeAPIKey(response.ID); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, ok := service.AuthenticateAPIKey(response.Key, "10.1.2.3"); ok {
+		t.Fatal("Expected a revoked key to be refused")
+	}
+}
@@ -0,0 +1,272 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is one entry of a KeyRing. Keys without a private half can only
+// verify. A key whose RetireAt has passed no longer verifies anything.
+type SigningKey struct {
+	ID       string
+	Method   jwt.SigningMethod
+	RetireAt time.Time
+
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+func (k *SigningKey) canSign() bool {
+	return k.signKey != nil
+}
+
+func (k *SigningKey) retired(now time.Time) bool {
+	return !k.RetireAt.IsZero() && !now.Before(k.RetireAt)
+}
+
+// KeyRing holds the keys tokens are signed and verified with. New tokens are
+// signed by the active key and carry its ID in the kid header; tokens without
+// a kid are verified by the key with an empty ID, which is how tokens issued
+// before key rotation keep working.
+type KeyRing struct {
+	keys   map[string]*SigningKey
+	active *SigningKey
+}
+
+// NewHMACKeyRing wraps a single shared secret. Its tokens carry no kid, so
+// they are exactly the tokens the service issued before it had a key ring.
+func NewHMACKeyRing(secret string) *KeyRing {
+	key := &SigningKey{Method: jwt.SigningMethodHS256, signKey: []byte(secret), verifyKey: []byte(secret)}
+	return &KeyRing{keys: map[string]*SigningKey{"": key}, active: key}
+}
+
+// keyRingFile is the SIGNING_KEYS_PATH format. Paths are relative to the
+// file itself.
+type keyRingFile struct {
+	Active string `json:"active"`
+	Keys   []struct {
+		ID             string    `json:"id"`
+		Alg            string    `json:"alg"`
+		Secret         string    `json:"secret,omitempty"`
+		PrivateKeyFile string    `json:"private_key_file,omitempty"`
+		PublicKeyFile  string    `json:"public_key_file,omitempty"`
+		RetireAt       time.Time `json:"retire_at,omitempty"`
+	} `json:"keys"`
+}
+
+// LoadKeyRing reads a key ring description. HS256 keys take a secret; RS256
+// and EdDSA keys take a PEM private key, or only a public key for keys that
+// are kept around to verify tokens another instance signed.
+func LoadKeyRing(path string) (*KeyRing, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open key ring: %w", err)
+	}
+
+	var file keyRingFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse key ring: %w", err)
+	}
+
+	ring := &KeyRing{keys: make(map[string]*SigningKey)}
+	dir := filepath.Dir(path)
+	for _, entry := range file.Keys {
+		if entry.ID == "" {
+			return nil, errors.New("key ring: every key needs an id")
+		}
+		if _, exists := ring.keys[entry.ID]; exists {
+			return nil, fmt.Errorf("key ring: duplicate key id %q", entry.ID)
+		}
+
+		key := &SigningKey{ID: entry.ID, RetireAt: entry.RetireAt}
+		switch entry.Alg {
+		case "HS256":
+			if entry.Secret == "" {
+				return nil, fmt.Errorf("key ring: key %q needs a secret", entry.ID)
+			}
+			key.Method = jwt.SigningMethodHS256
+			key.signKey = []byte(entry.Secret)
+			key.verifyKey = []byte(entry.Secret)
+		case "RS256":
+			key.Method = jwt.SigningMethodRS256
+			err = loadPEMKey(key, dir, entry.PrivateKeyFile, entry.PublicKeyFile,
+				func(pem []byte) (interface{}, error) { return jwt.ParseRSAPrivateKeyFromPEM(pem) },
+				func(pem []byte) (interface{}, error) { return jwt.ParseRSAPublicKeyFromPEM(pem) },
+				func(private interface{}) interface{} { return &private.(*rsa.PrivateKey).PublicKey })
+		case "EdDSA":
+			key.Method = jwt.SigningMethodEdDSA
+			err = loadPEMKey(key, dir, entry.PrivateKeyFile, entry.PublicKeyFile,
+				func(pem []byte) (interface{}, error) { return jwt.ParseEdPrivateKeyFromPEM(pem) },
+				func(pem []byte) (interface{}, error) { return jwt.ParseEdPublicKeyFromPEM(pem) },
+				func(private interface{}) interface{} { return private.(crypto.Signer).Public() })
+		default:
+			return nil, fmt.Errorf("key ring: key %q has unsupported alg %q, expected HS256, RS256 or EdDSA", entry.ID, entry.Alg)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key ring: key %q: %w", entry.ID, err)
+		}
+
+		ring.keys[key.ID] = key
+	}
+
+	active, exists := ring.keys[file.Active]
+	if !exists {
+		return nil, fmt.Errorf("key ring: active key %q is not in the ring", file.Active)
+	}
+	if !active.canSign() {
+		return nil, fmt.Errorf("key ring: active key %q has no private key", file.Active)
+	}
+	if !active.RetireAt.IsZero() {
+		return nil, fmt.Errorf("key ring: active key %q must not have retire_at", file.Active)
+	}
+	ring.active = active
+
+	return ring, nil
+}
+
+func loadPEMKey(key *SigningKey, dir, privateFile, publicFile string,
+	parsePrivate, parsePublic func([]byte) (interface{}, error),
+	publicOf func(interface{}) interface{}) error {
+	if privateFile != "" {
+		data, err := os.ReadFile(resolvePath(dir, privateFile))
+		if err != nil {
+			return err
+		}
+		private, err := parsePrivate(data)
+		if err != nil {
+			return err
+		}
+		key.signKey = private
+		key.verifyKey = publicOf(private)
+		return nil
+	}
+
+	if publicFile == "" {
+		return errors.New("private_key_file or public_key_file is required")
+	}
+	data, err := os.ReadFile(resolvePath(dir, publicFile))
+	if err != nil {
+		return err
+	}
+	public, err := parsePublic(data)
+	if err != nil {
+		return err
+	}
+	key.verifyKey = public
+	return nil
+}
+
+func resolvePath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// AddVerifyKey adds a verification-only HMAC key. It is used to keep
+// accepting tokens signed with the old AUTH_SECRET_KEY after moving to a key
+// ring file.
+func (kr *KeyRing) AddVerifyKey(id, secret string) {
+	if _, exists := kr.keys[id]; exists {
+		return
+	}
+	kr.keys[id] = &SigningKey{ID: id, Method: jwt.SigningMethodHS256, verifyKey: []byte(secret)}
+}
+
+func (kr *KeyRing) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(kr.active.Method, claims)
+	if kr.active.ID != "" {
+		token.Header["kid"] = kr.active.ID
+	}
+	return token.SignedString(kr.active.signKey)
+}
+
+// methods lists the algorithms the ring can verify, so that a token cannot
+// pick an algorithm no key was meant for.
+func (kr *KeyRing) methods() []string {
+	seen := make(map[string]bool)
+	var methods []string
+	for _, key := range kr.keys {
+		if alg := key.Method.Alg(); !seen[alg] {
+			seen[alg] = true
+			methods = append(methods, alg)
+		}
+	}
+	return methods
+}
+
+// keyFunc picks the verification key by kid and insists that the token's alg
+// is the one that key was created for.
+func (kr *KeyRing) keyFunc(now func() time.Time) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, exists := kr.keys[kid]
+		if !exists {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		if key.retired(now()) {
+			return nil, fmt.Errorf("signing key %q is retired", kid)
+		}
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("signing key %q does not use %s", kid, token.Method.Alg())
+		}
+		return key.verifyKey, nil
+	}
+}
+
+// JWK is a public key in RFC 7517 form.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicKeys returns the asymmetric keys that are not retired, for services
+// that verify tokens without sharing a secret. HMAC keys are never published.
+func (kr *KeyRing) PublicKeys(now time.Time) JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range kr.keys {
+		if key.retired(now) {
+			continue
+		}
+
+		jwk := JWK{Kid: key.ID, Alg: key.Method.Alg(), Use: "sig"}
+		switch public := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"analytics-service/internal/userdb"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func writeKeyFile(t *testing.T, dir, name, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+		t.Fatalf("Failed to write key file: %v", err)
+	}
+}
+
+func writeKeyRing(t *testing.T, dir, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, "signing_keys.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write key ring: %v", err)
+	}
+	return path
+}
+
+func login(t *testing.T, service *Service) string {
+	t.Helper()
+	response, err := service.GenerateToken(&AuthRequest{Email: "test@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return response.Token
+}
+
+func TestService_KeyRotation(t *testing.T) {
+	tokenStore := userdb.NewTokenStore()
+	service := NewService("test-secret", tokenStore)
+	service.SetUserStore(newTestUsers(t))
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return now }
+
+	beforeRing := login(t, service)
+
+	dir := t.TempDir()
+	ring, err := LoadKeyRing(writeKeyRing(t, dir, `{
+		"active": "2024-01",
+		"keys": [{"id": "2024-01", "alg": "HS256", "secret": "first"}]
+	}`))
+	if err != nil {
+		t.Fatalf("Failed to load key ring: %v", err)
+	}
+	ring.AddVerifyKey("", "test-secret")
+	service.SetKeyRing(ring)
+
+	first := login(t, service)
+	parsed, _, _ := jwt.NewParser().ParseUnverified(first, &Claims{})
+	if parsed.Header["kid"] != "2024-01" {
+		t.Fatalf("Expected kid 2024-01, got %v", parsed.Header["kid"])
+	}
+
+	ring, err = LoadKeyRing(writeKeyRing(t, dir, `{
+		"active": "2024-02",
+		"keys": [
+			{"id": "2024-01", "alg": "HS256", "secret": "first", "retire_at": "2024-01-02T00:00:00Z"},
+			{"id": "2024-02", "alg": "HS256", "secret": "second"}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("Failed to load key ring: %v", err)
+	}
+	service.SetKeyRing(ring)
+
+	second := login(t, service)
+
+	for name, token := range map[string]string{"signed by the retiring key": first, "signed by the active key": second} {
+		if result, _ := service.ValidateToken(token); !result.Valid {
+			t.Fatalf("Expected token %s to be valid", name)
+		}
+	}
+	if result, _ := service.ValidateToken(beforeRing); result.Valid {
+		t.Fatal("Expected kid-less token to be invalid once the old secret is dropped from the ring")
+	}
+
+	now = now.Add(13 * time.Hour)
+	if result, _ := service.ValidateToken(first); result.Valid {
+		t.Fatal("Expected token signed by a retired key to be invalid")
+	}
+	if result, _ := service.ValidateToken(second); !result.Valid {
+		t.Fatal("Expected token signed by the active key to stay valid")
+	}
+}
+
+func TestService_KeyRing_Asymmetric(t *testing.T) {
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	writeKeyFile(t, dir, "rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate Ed25519 key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatalf("Failed to encode Ed25519 key: %v", err)
+	}
+	writeKeyFile(t, dir, "ed25519.pem", "PRIVATE KEY", der)
+
+	for _, tc := range []struct {
+		active string
+		kty    string
+	}{
+		{"rsa-1", "RSA"},
+		{"ed-1", "OKP"},
+	} {
+		ring, err := LoadKeyRing(writeKeyRing(t, dir, `{
+			"active": "`+tc.active+`",
+			"keys": [
+				{"id": "rsa-1", "alg": "RS256", "private_key_file": "rsa.pem"},
+				{"id": "ed-1", "alg": "EdDSA", "private_key_file": "ed25519.pem"},
+				{"id": "hmac-1", "alg": "HS256", "secret": "shared"}
+			]
+		}`))
+		if err != nil {
+			t.Fatalf("Failed to load key ring: %v", err)
+		}
+
+		service := NewService("test-secret", userdb.NewTokenStore())
+		service.SetUserStore(newTestUsers(t))
+		service.SetKeyRing(ring)
+
+		token := login(t, service)
+		if result, _ := service.ValidateToken(token); !result.Valid {
+			t.Fatalf("%s: expected token to be valid", tc.active)
+		}
+
+		jwks := service.PublicKeys()
+		if len(jwks.Keys) != 2 {
+			t.Fatalf("Expected the two asymmetric keys in the JWKS, got %+v", jwks.Keys)
+		}
+		for _, key := range jwks.Keys {
+			if key.Kid == tc.active && key.Kty != tc.kty {
+				t.Fatalf("Expected %s to be published as %s, got %s", tc.active, tc.kty, key.Kty)
+			}
+		}
+	}
+
+	// A token that names the RSA key but is signed as HS256 with the public
+	// key as the secret must not verify.
+	ring, err := LoadKeyRing(writeKeyRing(t, dir, `{
+		"active": "rsa-1",
+		"keys": [{"id": "rsa-1", "alg": "RS256", "private_key_file": "rsa.pem"}, {"id": "hmac-1", "alg": "HS256", "secret": "shared"}]
+	}`))
+	if err != nil {
+		t.Fatalf("Failed to load key ring: %v", err)
+	}
+	service := NewService("test-secret", userdb.NewTokenStore())
+	service.SetUserStore(newTestUsers(t))
+	service.SetKeyRing(ring)
+
+	claims, err := service.parseToken(login(t, service))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)})
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	forged.Header["kid"] = "rsa-1"
+	token, _ := forged.SignedString(publicPEM)
+	if result, _ := service.ValidateToken(token); result.Valid {
+		t.Fatal("Expected token with a mismatched alg to be invalid")
+	}
+}
+
+func TestLoadKeyRing_Invalid(t *testing.T) {
+	dir := t.TempDir()
+
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(edKey.Public())
+	writeKeyFile(t, dir, "ed25519.pub", "PUBLIC KEY", der)
+
+	testCases := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"unknown alg", `{"active": "a", "keys": [{"id": "a", "alg": "none"}]}`, "unsupported alg"},
+		{"missing id", `{"active": "", "keys": [{"alg": "HS256", "secret": "x"}]}`, "needs an id"},
+		{"duplicate id", `{"active": "a", "keys": [{"id": "a", "alg": "HS256", "secret": "x"}, {"id": "a", "alg": "HS256", "secret": "y"}]}`, "duplicate"},
+		{"missing active", `{"active": "b", "keys": [{"id": "a", "alg": "HS256", "secret": "x"}]}`, "not in the ring"},
+		{"public key only", `{"active": "a", "keys": [{"id": "a", "alg": "EdDSA", "public_key_file": "ed25519.pub"}]}`, "no private key"},
+		{"retiring active", `{"active": "a", "keys": [{"id": "a", "alg": "HS256", "secret": "x", "retire_at": "2024-01-01T00:00:00Z"}]}`, "retire_at"},
+	}
+
+	for _, tc := range testCases {
+		_, err := LoadKeyRing(writeKeyRing(t, dir, tc.content))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("%s: expected error containing %q, got %v", tc.name, tc.err, err)
+		}
+	}
+}
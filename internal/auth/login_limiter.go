@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAccountFailures = 5
+	defaultIPFailures      = 20
+	defaultLockout         = 30 * time.Second
+	defaultMaxLockout      = 15 * time.Minute
+
+	// limiterPruneSize is how many tracked accounts or addresses trigger a
+	// sweep of idle entries, so a spray of made-up emails cannot grow the
+	// maps without bound.
+	limiterPruneSize = 10000
+
+	// inFlightWait is the Retry-After for an attempt refused because the
+	// ones already running could use up the limit; a password check takes
+	// well under a second.
+	inFlightWait = time.Second
+)
+
+// LoginLimiter throttles password checks per account and per client IP.
+// Once either has failed its limit in a row, further attempts are refused
+// for a lockout that doubles with every additional failure, up to
+// maxLockout. Failures are forgotten after maxLockout without new ones.
+//
+// Check admits an attempt by taking an in-flight slot before the password is
+// checked, and no more attempts run at once than failures are left before
+// the lockout, so parallel requests cannot outrun the counter. Every admitted
+// attempt must end in exactly one of Failure, Success or Release.
+type LoginLimiter struct {
+	accountFailures int
+	ipFailures      int
+	lockout         time.Duration
+	maxLockout      time.Duration
+
+	accounts map[string]*loginFailures
+	ips      map[string]*loginFailures
+	mu       sync.Mutex
+	now      func() time.Time
+}
+
+type loginFailures struct {
+	count       int
+	pending     int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+func NewLoginLimiter() *LoginLimiter {
+	return &LoginLimiter{
+		accountFailures: defaultAccountFailures,
+		ipFailures:      defaultIPFailures,
+		lockout:         defaultLockout,
+		maxLockout:      defaultMaxLockout,
+		accounts:        make(map[string]*loginFailures),
+		ips:             make(map[string]*loginFailures),
+		now:             time.Now,
+	}
+}
+
+// SetLimits sets how many failures in a row lock an account or an IP.
+func (l *LoginLimiter) SetLimits(accountFailures, ipFailures int) {
+	if accountFailures > 0 {
+		l.accountFailures = accountFailures
+	}
+	if ipFailures > 0 {
+		l.ipFailures = ipFailures
+	}
+}
+
+// SetLockout sets the first lockout and the cap it doubles up to.
+func (l *LoginLimiter) SetLockout(lockout, maxLockout time.Duration) {
+	if lockout > 0 {
+		l.lockout = lockout
+	}
+	if maxLockout >= l.lockout {
+		l.maxLockout = maxLockout
+	}
+}
+
+// Check returns how long the account or IP is still locked out, or zero if
+// an attempt may go ahead, in which case the attempt is admitted. It is
+// called before the password is checked, so a locked account cannot be
+// probed even with the right password.
+func (l *LoginLimiter) Check(ip, email string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	ipEntry := l.entry(l.ips, ip, now)
+	accountEntry := l.entry(l.accounts, accountKey(email), now)
+
+	wait := l.wait(ipEntry, l.ipFailures, now)
+	if accountWait := l.wait(accountEntry, l.accountFailures, now); accountWait > wait {
+		wait = accountWait
+	}
+	if wait > 0 {
+		return wait
+	}
+
+	ipEntry.pending++
+	accountEntry.pending++
+	return 0
+}
+
+// Failure ends an attempt with a wrong password and returns the lockout it
+// starts, or zero while the limits are not reached yet.
+func (l *LoginLimiter) Failure(ip, email string) (time.Duration, LoginFailureCounts) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	ipWait, ipCount := l.fail(l.ips, ip, l.ipFailures, now)
+	accountWait, accountCount := l.fail(l.accounts, accountKey(email), l.accountFailures, now)
+
+	wait := ipWait
+	if accountWait > wait {
+		wait = accountWait
+	}
+	return wait, LoginFailureCounts{Account: accountCount, IP: ipCount}
+}
+
+// LoginFailureCounts are the failures in a row behind a lockout, for the
+// security log.
+type LoginFailureCounts struct {
+	Account int
+	IP      int
+}
+
+// Success ends an attempt with the right password and clears the account's
+// failures. The IP's are left to expire, so a client cannot reset its
+// counter by logging in to an account it owns between guesses at others.
+func (l *LoginLimiter) Success(ip, email string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	release(l.ips, ip)
+	key := accountKey(email)
+	if entry, exists := l.accounts[key]; exists {
+		entry.count = 0
+		entry.lockedUntil = time.Time{}
+		release(l.accounts, key)
+	}
+}
+
+// Release ends an attempt that failed for a reason other than the
+// password, without counting it.
+func (l *LoginLimiter) Release(ip, email string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	release(l.ips, ip)
+	release(l.accounts, accountKey(email))
+}
+
+// entry returns the failures tracked for key, starting over once the old
+// ones are forgotten.
+func (l *LoginLimiter) entry(entries map[string]*loginFailures, key string, now time.Time) *loginFailures {
+	if len(entries) >= limiterPruneSize {
+		l.prune(entries, now)
+	}
+
+	entry, exists := entries[key]
+	if !exists || l.expired(entry, now) {
+		entry = &loginFailures{}
+		entries[key] = entry
+	}
+	return entry
+}
+
+// wait is how long a new attempt has to wait: the rest of the lockout, or
+// a moment while the attempts in flight could reach the limit on their own.
+func (l *LoginLimiter) wait(entry *loginFailures, limit int, now time.Time) time.Duration {
+	if wait := remaining(entry, now); wait > 0 {
+		return wait
+	}
+	if entry.pending > 0 && entry.count+entry.pending >= limit {
+		return inFlightWait
+	}
+	return 0
+}
+
+func (l *LoginLimiter) fail(entries map[string]*loginFailures, key string, limit int, now time.Time) (time.Duration, int) {
+	entry := l.entry(entries, key, now)
+	if entry.pending > 0 {
+		entry.pending--
+	}
+
+	entry.count++
+	entry.last = now
+	if entry.count < limit {
+		return 0, entry.count
+	}
+
+	wait := l.maxLockout
+	if doublings := entry.count - limit; doublings < 32 && l.lockout<<doublings < l.maxLockout {
+		wait = l.lockout << doublings
+	}
+	entry.lockedUntil = now.Add(wait)
+	return wait, entry.count
+}
+
+func (l *LoginLimiter) expired(entry *loginFailures, now time.Time) bool {
+	return entry.pending == 0 && !now.Before(entry.lockedUntil) && now.Sub(entry.last) > l.maxLockout
+}
+
+func (l *LoginLimiter) prune(entries map[string]*loginFailures, now time.Time) {
+	for key, entry := range entries {
+		if l.expired(entry, now) {
+			delete(entries, key)
+		}
+	}
+}
+
+// release frees an attempt's slot and forgets an entry left with nothing to
+// track.
+func release(entries map[string]*loginFailures, key string) {
+	entry, exists := entries[key]
+	if !exists {
+		return
+	}
+	if entry.pending > 0 {
+		entry.pending--
+	}
+	if entry.pending == 0 && entry.count == 0 {
+		delete(entries, key)
+	}
+}
+
+func remaining(entry *loginFailures, now time.Time) time.Duration {
+	if entry == nil || !now.Before(entry.lockedUntil) {
+		return 0
+	}
+	return entry.lockedUntil.Sub(now)
+}
+
+// accountKey matches the user store's email normalization, so changing the
+// case of an email does not buy an attacker a fresh counter.
+func accountKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginLimiter_AccountLockout(t *testing.T) {
+	limiter := NewLoginLimiter()
+	limiter.SetLimits(3, 100)
+	limiter.SetLockout(time.Minute, 10*time.Minute)
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+
+	for i := 1; i < 3; i++ {
+		if wait, counts := limiter.Failure("10.0.0.1", "test@example.com"); wait != 0 || counts.Account != i {
+			t.Fatalf("Failure %d: expected no lockout, got %s after %d failures", i, wait, counts.Account)
+		}
+	}
+
+	testCases := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 10 * time.Minute, 10 * time.Minute}
+	for i, expected := range testCases {
+		if wait, _ := limiter.Failure("10.0.0.1", "Test@Example.com "); wait != expected {
+			t.Fatalf("Failure %d: expected lockout %s, got %s", i+3, expected, wait)
+		}
+		if wait := limiter.Check("10.0.0.2", "test@example.com"); wait != expected {
+			t.Fatalf("Failure %d: expected the account to be locked from any IP for %s, got %s", i+3, expected, wait)
+		}
+		now = now.Add(expected)
+	}
+
+	if wait := limiter.Check("10.0.0.1", "test@example.com"); wait != 0 {
+		t.Fatalf("Expected lockout to be over, got %s", wait)
+	}
+	limiter.Release("10.0.0.1", "test@example.com")
+
+	now = now.Add(11 * time.Minute)
+	if wait, counts := limiter.Failure("10.0.0.1", "test@example.com"); wait != 0 || counts.Account != 1 {
+		t.Fatalf("Expected failures to be forgotten, got %s after %d failures", wait, counts.Account)
+	}
+
+	limiter.Failure("10.0.0.1", "test@example.com")
+	limiter.Success("10.0.0.1", "test@example.com")
+	if _, counts := limiter.Failure("10.0.0.1", "test@example.com"); counts.Account != 1 {
+		t.Fatalf("Expected success to clear the account's failures, got %d", counts.Account)
+	}
+}
+
+func TestLoginLimiter_IPLockout(t *testing.T) {
+	limiter := NewLoginLimiter()
+	limiter.SetLimits(100, 3)
+	limiter.SetLockout(time.Minute, time.Hour)
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+
+	limiter.Failure("10.0.0.1", "a@example.com")
+	limiter.Failure("10.0.0.1", "b@example.com")
+	limiter.Success("10.0.0.1", "c@example.com")
+	if wait, counts := limiter.Failure("10.0.0.1", "c@example.com"); wait != time.Minute || counts.IP != 3 {
+		t.Fatalf("Expected IP lockout after 3 failures across accounts, got %s after %d", wait, counts.IP)
+	}
+
+	if wait := limiter.Check("10.0.0.1", "d@example.com"); wait != time.Minute {
+		t.Fatalf("Expected the IP to be locked for every account, got %s", wait)
+	}
+	if wait := limiter.Check("10.0.0.2", "a@example.com"); wait != 0 {
+		t.Fatalf("Expected other IPs to be unaffected, got %s", wait)
+	}
+}
+
+func TestLoginLimiter_ParallelAttempts(t *testing.T) {
+	limiter := NewLoginLimiter()
+	limiter.SetLimits(3, 100)
+	limiter.SetLockout(time.Minute, time.Hour)
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+
+	admitted := 0
+	for i := 0; i < 10; i++ {
+		if limiter.Check("10.0.0.1", "test@example.com") == 0 {
+			admitted++
+		}
+	}
+	if admitted != 3 {
+		t.Fatalf("Expected only as many attempts in flight as failures are allowed, got %d", admitted)
+	}
+	if wait := limiter.Check("10.0.0.2", "test@example.com"); wait != inFlightWait {
+		t.Fatalf("Expected the account to be busy from any IP, got %s", wait)
+	}
+
+	limiter.Release("10.0.0.1", "test@example.com")
+	if wait := limiter.Check("10.0.0.1", "test@example.com"); wait != 0 {
+		t.Fatalf("Expected a released slot to admit another attempt, got %s", wait)
+	}
+
+	for i := 0; i < 3; i++ {
+		limiter.Failure("10.0.0.1", "test@example.com")
+	}
+	if wait := limiter.Check("10.0.0.1", "test@example.com"); wait != time.Minute {
+		t.Fatalf("Expected the account to be locked after the attempts failed, got %s", wait)
+	}
+
+	now = now.Add(time.Minute)
+	if wait := limiter.Check("10.0.0.1", "test@example.com"); wait != 0 {
+		t.Fatalf("Expected one attempt after the lockout, got %s", wait)
+	}
+	if wait := limiter.Check("10.0.0.1", "test@example.com"); wait != inFlightWait {
+		t.Fatalf("Expected a second attempt after the lockout to wait, got %s", wait)
+	}
+
+	limiter.Success("10.0.0.1", "test@example.com")
+	if wait := limiter.Check("10.0.0.1", "test@example.com"); wait != 0 {
+		t.Fatalf("Expected success to clear the account, got %s", wait)
+	}
+}
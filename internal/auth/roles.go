@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+
+	"analytics-service/internal/userdb"
+)
+
+// Permission is what a route requires of the caller's role.
+type Permission string
+
+const (
+	// PermReadAnalytics allows the item analytics report.
+	PermReadAnalytics Permission = "analytics:read"
+	// PermExploreAnalytics allows the time series and group drill-downs.
+	PermExploreAnalytics Permission = "analytics:explore"
+	// PermAdmin allows uploads, reloads and token revocation.
+	PermAdmin Permission = "admin"
+)
+
+var rolePermissions = map[string][]Permission{
+	userdb.RoleViewer:  {PermReadAnalytics},
+	userdb.RoleAnalyst: {PermReadAnalytics, PermExploreAnalytics},
+	userdb.RoleAdmin:   {PermReadAnalytics, PermExploreAnalytics, PermAdmin},
+}
+
+// Can reports whether the principal's role, or for API keys its scopes,
+// grants perm. Unknown roles grant nothing.
+func (p *Principal) Can(perm Permission) bool {
+	permissions := rolePermissions[p.Role]
+	if p.APIKeyID != "" {
+		permissions = p.Scopes
+	}
+
+	for _, granted := range permissions {
+		if granted == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// String names the principal in logs.
+func (p *Principal) String() string {
+	if p.APIKeyID != "" {
+		return fmt.Sprintf("API key %s", p.APIKeyID)
+	}
+	return fmt.Sprintf("user %d (%s)", p.UserID, p.Role)
+}
+
+func knownPermission(perm Permission) bool {
+	for _, known := range rolePermissions[userdb.RoleAdmin] {
+		if known == perm {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok
+}
@@ -2,11 +2,15 @@ package auth
 
 import (
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"strings"
+	"log"
+	"strconv"
 	"time"
 
 	"analytics-service/internal/userdb"
@@ -14,9 +18,31 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+const (
+	defaultIssuer     = "analytics-service"
+	defaultTokenTTL   = 24 * time.Hour
+	defaultRefreshTTL = 30 * 24 * time.Hour
+	defaultClockSkew  = time.Minute
+)
+
+var (
+	ErrInvalidCredentials = userdb.ErrInvalidCredentials
+	ErrInvalidToken       = errors.New("invalid token")
+)
+
 type Service struct {
-	secretKey  string
-	tokenStore *userdb.TokenStore
+	secretKey    string
+	keys         *KeyRing
+	tokenStore   userdb.TokenStore
+	users        *userdb.UserStore
+	apiKeys      *userdb.APIKeyStore
+	legacyTokens bool
+	admins       map[int]bool
+	issuer       string
+	tokenTTL     time.Duration
+	refreshTTL   time.Duration
+	clockSkew    time.Duration
+	now          func() time.Time
 }
 
 type AuthRequest struct {
@@ -25,93 +51,498 @@ type AuthRequest struct {
 }
 
 type AuthResponse struct {
+	Token            string    `json:"token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type RegisterResponse struct {
+	ID    int    `json:"id"`
+	Email string `json:"email"`
+}
+
+type ChangePasswordRequest struct {
+	Email       string `json:"email"`
+	Password    string `json:"password"`
+	NewPassword string `json:"new_password"`
+}
+
+type LogoutRequest struct {
 	Token string `json:"token"`
 }
 
+type RevokeUserRequest struct {
+	Token  string `json:"token"`
+	UserID int    `json:"user_id"`
+}
+
+type RevokeUserResponse struct {
+	Revoked int `json:"revoked"`
+}
+
 type ValidateResponse struct {
-	Valid bool `json:"valid"`
+	Valid  bool   `json:"valid"`
+	UserID int    `json:"user_id,omitempty"`
+	Tenant string `json:"tenant,omitempty"`
+	Role   string `json:"role,omitempty"`
+}
+
+// Principal is who a token speaks for. Tenant selects the dataset the caller
+// may read; an empty tenant reads nothing. Principals of API keys have no user
+// and carry the key's scopes instead of a role.
+type Principal struct {
+	UserID   int
+	Email    string
+	Tenant   string
+	Role     string
+	APIKeyID string
+	Scopes   []Permission
 }
 
-func NewService(secretKey string, tokenStore *userdb.TokenStore) *Service {
+// Claims are the identity claims carried by issued tokens. The subject is the
+// user ID and the token ID (jti) is what the token store tracks.
+type Claims struct {
+	Email  string `json:"email,omitempty"`
+	Tenant string `json:"tenant,omitempty"`
+	Role   string `json:"role,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func NewService(secretKey string, tokenStore userdb.TokenStore) *Service {
 	return &Service{
-		secretKey:  secretKey,
-		tokenStore: tokenStore,
+		secretKey:    secretKey,
+		keys:         NewHMACKeyRing(secretKey),
+		tokenStore:   tokenStore,
+		users:        userdb.NewUserStore(),
+		apiKeys:      userdb.NewAPIKeyStore(),
+		legacyTokens: true,
+		issuer:       defaultIssuer,
+		tokenTTL:     defaultTokenTTL,
+		refreshTTL:   defaultRefreshTTL,
+		clockSkew:    defaultClockSkew,
+		now:          time.Now,
+	}
+}
+
+func (s *Service) SetUserStore(users *userdb.UserStore) {
+	if users != nil {
+		s.users = users
+	}
+}
+
+// SetKeyRing replaces the single secret tokens are signed with by a ring of
+// rotating keys. The secret is still used for legacy tokens.
+func (s *Service) SetKeyRing(keys *KeyRing) {
+	if keys != nil {
+		s.keys = keys
+	}
+}
+
+// PublicKeys returns the JWKS of the asymmetric keys tokens may be signed
+// with.
+func (s *Service) PublicKeys() JWKSet {
+	return s.keys.PublicKeys(s.now())
+}
+
+// SetLegacyTokens toggles compatibility with the opaque tokens listed in
+// LogPas.txt: accepting them as-is and logging in with the credentials they
+// were derived from. Turn it off once those tokens have been rotated out.
+func (s *Service) SetLegacyTokens(enabled bool) {
+	s.legacyTokens = enabled
+}
+
+// SetAdmins lists the user IDs that are admins when their account or token
+// carries no role of its own.
+func (s *Service) SetAdmins(userIDs []int) {
+	s.admins = make(map[int]bool, len(userIDs))
+	for _, id := range userIDs {
+		s.admins[id] = true
+	}
+}
+
+func (s *Service) SetIssuer(issuer string) {
+	if issuer != "" {
+		s.issuer = issuer
+	}
+}
+
+func (s *Service) SetTokenTTL(ttl time.Duration) {
+	if ttl > 0 {
+		s.tokenTTL = ttl
+	}
+}
+
+func (s *Service) SetRefreshTTL(ttl time.Duration) {
+	if ttl > 0 {
+		s.refreshTTL = ttl
+	}
+}
+
+// SetClockSkew sets how far exp/iat may drift from the local clock before a
+// token is rejected.
+func (s *Service) SetClockSkew(skew time.Duration) {
+	if skew >= 0 {
+		s.clockSkew = skew
 	}
 }
 
 func (s *Service) GenerateToken(req *AuthRequest) (*AuthResponse, error) {
-	token, err := s.createJWTToken(req.Email, req.Password)
+	principal, ok := s.authenticate(req.Email, req.Password)
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	family, err := newTokenID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token: %w", err)
+	}
+
+	return s.issuePair(principal, family)
+}
+
+// Refresh trades a refresh token for a new access/refresh pair of the same
+// family. Each refresh token works once: presenting one that was already
+// used means it leaked, so the whole family is revoked and the user has to
+// log in again.
+func (s *Service) Refresh(req *RefreshRequest) (*AuthResponse, error) {
+	record, err := s.tokenStore.ConsumeToken(refreshKey(req.RefreshToken))
+	if errors.Is(err, userdb.ErrTokenReused) {
+		revoked, err := s.tokenStore.RevokeFamily(record.Family)
+		if err != nil {
+			return nil, fmt.Errorf("failed to revoke token family: %w", err)
+		}
+		log.Printf("Refresh token of user %d reused, revoked %d tokens of its family", record.UserID, revoked)
+		return nil, ErrInvalidToken
+	}
+	if errors.Is(err, userdb.ErrTokenNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	if record.Kind != userdb.KindRefresh || !s.now().Before(record.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+
+	principal := s.newPrincipal(record.UserID, "", record.Tenant, record.Role)
+	if user, ok := s.users.GetUser(record.UserID); ok {
+		if user.Disabled {
+			return nil, ErrInvalidToken
+		}
+		principal = s.newPrincipal(user.ID, user.Email, user.Tenant, user.Role)
+	}
+
+	return s.issuePair(principal, record.Family)
+}
+
+// issuePair signs an access token and creates a refresh token for principal.
+// Only the refresh token's hash is stored.
+func (s *Service) issuePair(principal *Principal, family string) (*AuthResponse, error) {
+	token, claims, err := s.issueToken(principal)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create token: %w", err)
 	}
 
-	s.tokenStore.AddToken(token, 1)
+	refreshToken, err := newTokenID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token: %w", err)
+	}
+	refreshExpiresAt := claims.IssuedAt.Time.Add(s.refreshTTL)
+
+	records := []userdb.TokenRecord{
+		{
+			Token:     claims.ID,
+			UserID:    principal.UserID,
+			Tenant:    principal.Tenant,
+			Role:      principal.Role,
+			Family:    family,
+			CreatedAt: claims.IssuedAt.Time,
+			ExpiresAt: claims.ExpiresAt.Time.Add(s.clockSkew),
+		},
+		{
+			Token:     refreshKey(refreshToken),
+			UserID:    principal.UserID,
+			Tenant:    principal.Tenant,
+			Role:      principal.Role,
+			Kind:      userdb.KindRefresh,
+			Family:    family,
+			CreatedAt: claims.IssuedAt.Time,
+			ExpiresAt: refreshExpiresAt,
+		},
+	}
+	for _, record := range records {
+		if err := s.tokenStore.SaveToken(record); err != nil {
+			return nil, fmt.Errorf("failed to store token: %w", err)
+		}
+	}
+
+	return &AuthResponse{
+		Token:            token,
+		ExpiresAt:        claims.ExpiresAt.Time,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: refreshExpiresAt,
+	}, nil
+}
+
+func (s *Service) Register(req *AuthRequest) (*RegisterResponse, error) {
+	// LogPas.txt clients exist only in the token store; a new account must
+	// not share their ID and with it their tenant and revocations.
+	user, err := s.users.Register(req.Email, req.Password, s.tokenStore.MaxUserID())
+	if err != nil {
+		return nil, err
+	}
+
+	return &RegisterResponse{ID: user.ID, Email: user.Email}, nil
+}
+
+// ChangePassword sets a new password and revokes every token the account
+// holds, so a leaked session does not outlive the old password.
+func (s *Service) ChangePassword(req *ChangePasswordRequest) error {
+	if err := s.users.ChangePassword(req.Email, req.Password, req.NewPassword); err != nil {
+		return err
+	}
+
+	user, ok := s.users.GetUserByEmail(req.Email)
+	if !ok {
+		return userdb.ErrUserNotFound
+	}
 
-	return &AuthResponse{Token: token}, nil
+	_, err := s.RevokeUserTokens(user.ID)
+	return err
+}
+
+// DisableAccount locks the caller's own account after re-checking the
+// password and revokes every token it still holds.
+func (s *Service) DisableAccount(req *AuthRequest) error {
+	user, ok := s.users.VerifyCredentials(req.Email, req.Password)
+	if !ok {
+		return ErrInvalidCredentials
+	}
+
+	if err := s.users.Disable(req.Email); err != nil {
+		return err
+	}
+
+	_, err := s.RevokeUserTokens(user.ID)
+	return err
 }
 
 func (s *Service) ValidateToken(token string) (*ValidateResponse, error) {
-	userID, exists := s.tokenStore.ValidateToken(token)
-	if !exists {
+	principal, ok := s.Authenticate(token)
+	if !ok {
 		return &ValidateResponse{Valid: false}, nil
 	}
 
-	if userID != 1 {
-		return &ValidateResponse{Valid: false}, nil
+	return &ValidateResponse{Valid: true, UserID: principal.UserID, Tenant: principal.Tenant, Role: principal.Role}, nil
+}
+
+func (s *Service) authenticate(email, password string) (*Principal, bool) {
+	if user, ok := s.users.VerifyCredentials(email, password); ok {
+		return s.newPrincipal(user.ID, user.Email, user.Tenant, user.Role), true
 	}
 
-	return &ValidateResponse{Valid: true}, nil
+	if !s.legacyTokens {
+		return nil, false
+	}
+
+	token, err := legacyToken(s.secretKey, email, password)
+	if err != nil {
+		return nil, false
+	}
+
+	record, exists := s.tokenStore.LookupToken(token)
+	if !exists {
+		return nil, false
+	}
+	return s.legacyPrincipal(record, email), true
+}
+
+// newPrincipal fills in the role for accounts created before roles existed:
+// users listed in SetAdmins are admins and everyone else keeps the analyst
+// access they had before. An account without a tenant has no dataset.
+func (s *Service) newPrincipal(userID int, email, tenant, role string) *Principal {
+	if role == "" {
+		role = userdb.RoleAnalyst
+		if s.admins[userID] {
+			role = userdb.RoleAdmin
+		}
+	}
+
+	return &Principal{UserID: userID, Email: email, Tenant: tenant, Role: role}
 }
 
-func (s *Service) createJWTToken(email, password string) (string, error) {
-	header := map[string]string{
-		"alg": "HS256",
-		"typ": "JWT",
+// legacyPrincipal is newPrincipal for a LogPas.txt token. User 1 was the only
+// client the service ever accepted, so without an explicit tenant it reads
+// the shared dumps. Tokens issued to it carry that tenant in their record.
+func (s *Service) legacyPrincipal(record userdb.TokenRecord, email string) *Principal {
+	tenant := record.Tenant
+	if tenant == "" && record.UserID == 1 {
+		tenant = userdb.DefaultTenant
 	}
+	return s.newPrincipal(record.UserID, email, tenant, record.Role)
+}
 
-	payload := map[string]string{
-		"email":    email,
-		"password": password,
+// Logout revokes the given token together with the refresh token issued
+// alongside it. The token must still be valid.
+func (s *Service) Logout(token string) error {
+	key, _, ok := s.lookupToken(token)
+	if !ok {
+		return ErrInvalidToken
 	}
 
-	headerJSON, err := json.Marshal(header)
+	record, _ := s.tokenStore.LookupToken(key)
+	if record.Family != "" {
+		_, err := s.tokenStore.RevokeFamily(record.Family)
+		if err != nil {
+			return fmt.Errorf("failed to revoke token: %w", err)
+		}
+		return nil
+	}
+
+	if err := s.tokenStore.RevokeToken(key); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	return nil
+}
+
+func (s *Service) IsAdmin(token string) bool {
+	_, principal, ok := s.lookupToken(token)
+	return ok && principal.Can(PermAdmin)
+}
+
+// RevokeUserTokens revokes every token issued to userID, including legacy
+// ones, and returns how many were revoked.
+func (s *Service) RevokeUserTokens(userID int) (int, error) {
+	revoked, err := s.tokenStore.RevokeUserTokens(userID)
 	if err != nil {
-		return "", err
+		return revoked, fmt.Errorf("failed to revoke tokens: %w", err)
 	}
-	headerB64 := base64URLEncode(headerJSON)
+	return revoked, nil
+}
 
-	payloadJSON, err := json.Marshal(payload)
+// Authenticate returns the principal a token belongs to. Signed tokens must
+// pass signature and claim checks and still be listed in the token store by
+// jti; in legacy mode anything else is looked up verbatim so that the opaque
+// tokens preloaded from LogPas.txt keep working.
+func (s *Service) Authenticate(token string) (*Principal, bool) {
+	_, principal, ok := s.lookupToken(token)
+	return principal, ok
+}
+
+// lookupToken also returns the token store key of token: the jti for signed
+// tokens and the token itself for legacy ones. The tenant always comes from
+// the store record.
+func (s *Service) lookupToken(token string) (string, *Principal, bool) {
+	claims, err := s.parseToken(token)
 	if err != nil {
-		return "", err
+		if !s.legacyTokens {
+			return "", nil, false
+		}
+		// Only tokens from LogPas.txt are opaque; the jti of an issued token
+		// is readable from its payload and must not work on its own.
+		record, exists := s.tokenStore.LookupToken(token)
+		if !exists || !record.IsLegacy() {
+			return "", nil, false
+		}
+		return token, s.legacyPrincipal(record, ""), true
 	}
-	payloadB64 := base64URLEncode(payloadJSON)
 
-	message := headerB64 + "." + payloadB64
+	record, exists := s.tokenStore.LookupToken(claims.ID)
+	if !exists || record.Kind != "" || strconv.Itoa(record.UserID) != claims.Subject {
+		return "", nil, false
+	}
 
-	h := hmac.New(sha256.New, []byte(s.secretKey))
-	h.Write([]byte(message))
-	signature := h.Sum(nil)
-	signatureB64 := base64URLEncode(signature)
+	return claims.ID, s.newPrincipal(record.UserID, claims.Email, record.Tenant, record.Role), true
+}
+
+func (s *Service) issueToken(principal *Principal) (string, *Claims, error) {
+	jti, err := newTokenID()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := s.now()
+	claims := &Claims{
+		Email:  principal.Email,
+		Tenant: principal.Tenant,
+		Role:   principal.Role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.issuer,
+			Subject:   strconv.Itoa(principal.UserID),
+			ID:        jti,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.tokenTTL)),
+		},
+	}
+
+	token, err := s.keys.sign(claims)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return token, claims, nil
+}
 
-	return message + "." + signatureB64, nil
+func (s *Service) parseToken(token string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(token, claims, s.keys.keyFunc(s.now),
+		jwt.WithValidMethods(s.keys.methods()),
+		jwt.WithIssuer(s.issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(s.clockSkew),
+		jwt.WithTimeFunc(s.now),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.ID == "" {
+		return nil, fmt.Errorf("token has no jti")
+	}
+
+	return claims, nil
+}
+
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
 }
 
-func base64URLEncode(data []byte) string {
-	encoded := base64.StdEncoding.EncodeToString(data)
-	encoded = strings.ReplaceAll(encoded, "+", "-")
-	encoded = strings.ReplaceAll(encoded, "/", "_")
-	encoded = strings.TrimRight(encoded, "=")
-	return encoded
+// refreshKey is what the token store keeps for a refresh token, so a leaked
+// journal cannot be replayed against /auth/refresh.
+func refreshKey(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(sum[:])
 }
 
-func (s *Service) createStandardJWTToken(email, password string) (string, error) {
-	claims := jwt.MapClaims{
-		"email":    email,
-		"password": password,
-		"exp":      time.Now().Add(time.Hour * 24).Unix(),
-		"iat":      time.Now().Unix(),
+// legacyToken rebuilds the token the old Python AuthAPI derived from a
+// credential pair. It is only used to match LogPas.txt entries and is never
+// handed out, since its payload carries the password in clear text.
+func legacyToken(secretKey, email, password string) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(s.secretKey))
+	payload, err := json.Marshal(map[string]string{"email": email, "password": password})
+	if err != nil {
+		return "", err
+	}
+
+	message := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	h := hmac.New(sha256.New, []byte(secretKey))
+	h.Write([]byte(message))
+
+	return message + "." + base64.RawURLEncoding.EncodeToString(h.Sum(nil)), nil
 }
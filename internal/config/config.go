@@ -1,26 +1,106 @@
 package config
 
 import (
+	"errors"
+	"log"
 	"os"
 	"strconv"
+	"strings"
 )
 
+// DefaultSecretKey is the AUTH_SECRET_KEY fallback. It is public, so
+// production deployments must not sign or verify anything with it.
+const DefaultSecretKey = "secret"
+
 type Config struct {
-	Port      string
-	SecretKey string
-	Workers   int
+	Environment        string
+	Port               string
+	SecretKey          string
+	SigningKeysPath    string
+	Workers            int
+	StockDumpPath      string
+	SalesDumpPath      string
+	DataReloadSec      int
+	DataCache          bool
+	TokenIssuer        string
+	TokenTTLSec        int
+	RefreshTTLSec      int
+	ClockSkewSec       int
+	UsersPath          string
+	APIKeysPath        string
+	LegacyTokens       bool
+	TokenParams        bool
+	LoginFailures      int
+	LoginIPFailures    int
+	LoginLockoutSec    int
+	LoginMaxLockoutSec int
+	TokenDBPath        string
+	AuditLogPath       string
+	AuditLogMaxSizeMB  int
+	AuditLogMaxFiles   int
+	LogPasPath         string
+	LogPasReloadSec    int
+	AdminUserIDs       []int
+	TenantsDir         string
 }
 
 func New() *Config {
 	workers := getEnvAsInt("WORKERS", 4)
-	
+
 	return &Config{
-		Port:      getEnv("PORT", "8080"),
-		SecretKey: getEnv("AUTH_SECRET_KEY", "secret"),
-		Workers:   workers,
+		Environment:        getEnv("APP_ENV", "development"),
+		Port:               getEnv("PORT", "8080"),
+		SecretKey:          getEnv("AUTH_SECRET_KEY", DefaultSecretKey),
+		SigningKeysPath:    getEnv("SIGNING_KEYS_PATH", ""),
+		Workers:            workers,
+		StockDumpPath:      getEnv("STOCK_DUMP_PATH", "routes/stock_dump.json"),
+		SalesDumpPath:      getEnv("SALES_DUMP_PATH", "routes/sales_dump.json"),
+		DataReloadSec:      getEnvAsInt("DATA_RELOAD_INTERVAL", 30),
+		DataCache:          getEnvAsBool("DATA_CACHE", true),
+		TokenIssuer:        getEnv("TOKEN_ISSUER", "analytics-service"),
+		TokenTTLSec:        getEnvAsInt("TOKEN_TTL", 86400),
+		RefreshTTLSec:      getEnvAsInt("REFRESH_TOKEN_TTL", 2592000),
+		ClockSkewSec:       getEnvAsInt("TOKEN_CLOCK_SKEW", 60),
+		UsersPath:          getEnv("USERS_PATH", "routes/users.json"),
+		APIKeysPath:        getEnv("API_KEYS_PATH", "routes/api_keys.json"),
+		LegacyTokens:       getEnvAsBool("LEGACY_TOKENS", true),
+		TokenParams:        getEnvAsBool("TOKEN_PARAMS", true),
+		LoginFailures:      getEnvAsInt("LOGIN_MAX_FAILURES", 5),
+		LoginIPFailures:    getEnvAsInt("LOGIN_IP_MAX_FAILURES", 20),
+		LoginLockoutSec:    getEnvAsInt("LOGIN_LOCKOUT", 30),
+		LoginMaxLockoutSec: getEnvAsInt("LOGIN_MAX_LOCKOUT", 900),
+		TokenDBPath:        getEnv("TOKEN_DB_PATH", "routes/tokens.jsonl"),
+		AuditLogPath:       getEnv("AUDIT_LOG_PATH", "routes/audit.jsonl"),
+		AuditLogMaxSizeMB:  getEnvAsInt("AUDIT_LOG_MAX_SIZE_MB", 100),
+		AuditLogMaxFiles:   getEnvAsInt("AUDIT_LOG_MAX_FILES", 10),
+		LogPasPath:         getEnv("LOGPAS_PATH", "routes/LogPas.txt"),
+		LogPasReloadSec:    getEnvAsInt("LOGPAS_RELOAD_INTERVAL", 5),
+		AdminUserIDs:       getEnvAsIntList("ADMIN_USER_IDS"),
+		TenantsDir:         getEnv("TENANTS_DIR", ""),
 	}
 }
 
+func (c *Config) IsProduction() bool {
+	return strings.EqualFold(c.Environment, "production")
+}
+
+// Validate rejects settings that are only acceptable in development. The
+// default secret still matters with a key ring as long as legacy tokens,
+// which are derived from it, are accepted.
+func (c *Config) Validate() error {
+	if !c.IsProduction() || c.SecretKey != DefaultSecretKey {
+		return nil
+	}
+
+	if c.SigningKeysPath == "" {
+		return errors.New("AUTH_SECRET_KEY must be set in production; the default secret is public")
+	}
+	if c.LegacyTokens {
+		return errors.New("AUTH_SECRET_KEY must be set in production while LEGACY_TOKENS is on; the default secret is public")
+	}
+	return nil
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -38,3 +118,29 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsIntList(key string) []int {
+	var values []int
+	for _, part := range strings.Split(os.Getenv(key), ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		intValue, err := strconv.Atoi(part)
+		if err != nil {
+			log.Printf("Warning: ignoring invalid %s entry %q", key, part)
+			continue
+		}
+		values = append(values, intValue)
+	}
+	return values
+}
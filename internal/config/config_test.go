@@ -25,6 +25,51 @@ func TestConfig_New(t *testing.T) {
 	if cfg.Workers != 4 {
 		t.Fatalf("Expected default workers 4, got %d", cfg.Workers)
 	}
+	
+	if cfg.StockDumpPath != "routes/stock_dump.json" {
+		t.Fatalf("Expected default stock dump path, got %s", cfg.StockDumpPath)
+	}
+	
+	if cfg.SalesDumpPath != "routes/sales_dump.json" {
+		t.Fatalf("Expected default sales dump path, got %s", cfg.SalesDumpPath)
+	}
+	
+	if cfg.TokenIssuer != "analytics-service" || cfg.TokenTTLSec != 86400 || cfg.RefreshTTLSec != 2592000 || cfg.ClockSkewSec != 60 {
+		t.Fatalf("Unexpected token defaults: issuer %s, ttl %d, refresh ttl %d, skew %d", cfg.TokenIssuer, cfg.TokenTTLSec, cfg.RefreshTTLSec, cfg.ClockSkewSec)
+	}
+	
+	if cfg.UsersPath != "routes/users.json" || !cfg.LegacyTokens || !cfg.TokenParams {
+		t.Fatalf("Unexpected user defaults: path %s, legacy tokens %v, token params %v", cfg.UsersPath, cfg.LegacyTokens, cfg.TokenParams)
+	}
+	
+	if cfg.LoginFailures != 5 || cfg.LoginIPFailures != 20 || cfg.LoginLockoutSec != 30 || cfg.LoginMaxLockoutSec != 900 {
+		t.Fatalf("Unexpected login limits: %d, %d, %d, %d", cfg.LoginFailures, cfg.LoginIPFailures, cfg.LoginLockoutSec, cfg.LoginMaxLockoutSec)
+	}
+	
+	if cfg.TokenDBPath != "routes/tokens.jsonl" || cfg.LogPasPath != "routes/LogPas.txt" || cfg.APIKeysPath != "routes/api_keys.json" {
+		t.Fatalf("Unexpected token store defaults: %s, %s, %s", cfg.TokenDBPath, cfg.LogPasPath, cfg.APIKeysPath)
+	}
+}
+
+func TestConfig_New_DumpPaths(t *testing.T) {
+
+	os.Setenv("STOCK_DUMP_PATH", "/data/stock.json")
+	os.Setenv("SALES_DUMP_PATH", "/data/sales.json")
+	
+	cfg := New()
+	
+
+	if cfg.StockDumpPath != "/data/stock.json" {
+		t.Fatalf("Expected stock dump path /data/stock.json, got %s", cfg.StockDumpPath)
+	}
+	
+	if cfg.SalesDumpPath != "/data/sales.json" {
+		t.Fatalf("Expected sales dump path /data/sales.json, got %s", cfg.SalesDumpPath)
+	}
+	
+
+	os.Unsetenv("STOCK_DUMP_PATH")
+	os.Unsetenv("SALES_DUMP_PATH")
 }
 
 func TestConfig_New_WithEnvironmentVariables(t *testing.T) {
@@ -140,3 +185,74 @@ func TestConfig_New_LargeWorkers(t *testing.T) {
 
 	os.Unsetenv("WORKERS")
 }
+
+
+func TestConfig_New_LegacyTokens(t *testing.T) {
+
+	os.Setenv("LEGACY_TOKENS", "false")
+	defer os.Unsetenv("LEGACY_TOKENS")
+	
+	if cfg := New(); cfg.LegacyTokens {
+		t.Fatal("Expected LEGACY_TOKENS=false to disable legacy tokens")
+	}
+	
+
+	os.Setenv("LEGACY_TOKENS", "not-a-bool")
+	
+	if cfg := New(); !cfg.LegacyTokens {
+		t.Fatal("Expected invalid LEGACY_TOKENS to fall back to the default")
+	}
+}
+
+func TestConfig_New_TokenParams(t *testing.T) {
+
+	os.Setenv("TOKEN_PARAMS", "false")
+	defer os.Unsetenv("TOKEN_PARAMS")
+	
+	if cfg := New(); cfg.TokenParams {
+		t.Fatal("Expected TOKEN_PARAMS=false to require the Authorization header")
+	}
+}
+
+func TestConfig_New_AdminUserIDs(t *testing.T) {
+
+	os.Setenv("ADMIN_USER_IDS", "1, 7,x")
+	defer os.Unsetenv("ADMIN_USER_IDS")
+	
+	cfg := New()
+	
+
+	if len(cfg.AdminUserIDs) != 2 || cfg.AdminUserIDs[0] != 1 || cfg.AdminUserIDs[1] != 7 {
+		t.Fatalf("Expected admin IDs [1 7], got %v", cfg.AdminUserIDs)
+	}
+}
+func TestConfig_Validate(t *testing.T) {
+
+	cfg := &Config{Environment: "development", SecretKey: DefaultSecretKey, LegacyTokens: true}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Expected the default secret to be fine in development, got %v", err)
+	}
+	
+
+	cfg.Environment = "production"
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("Expected the default secret to be rejected in production")
+	}
+	
+
+	cfg.SigningKeysPath = "keys.json"
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("Expected legacy tokens derived from the default secret to be rejected in production")
+	}
+
+	cfg.LegacyTokens = false
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Expected a key ring without legacy tokens to be accepted, got %v", err)
+	}
+	
+
+	cfg = &Config{Environment: "production", SecretKey: "a-real-secret", LegacyTokens: true}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Expected a custom secret to be accepted in production, got %v", err)
+	}
+}
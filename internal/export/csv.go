@@ -0,0 +1,51 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+
+	"analytics-service/internal/analytics"
+)
+
+const utf8BOM = "\xEF\xBB\xBF"
+
+// WriteCSV streams items in the layout Excel expects for Russian locales:
+// UTF-8 with BOM, semicolon separators and decimal commas.
+func WriteCSV(w io.Writer, items []analytics.ItemAnalyticsResult) error {
+	if _, err := io.WriteString(w, utf8BOM); err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Comma = ';'
+
+	record := make([]string, len(itemColumns))
+	for i, col := range itemColumns {
+		record[i] = col.header
+	}
+	if err := cw.Write(record); err != nil {
+		return err
+	}
+
+	for i := range items {
+		for j, col := range itemColumns {
+			if col.text != nil {
+				record[j] = col.text(&items[i])
+			} else {
+				record[j] = formatDecimal(col.number(&items[i]), col.decimals)
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatDecimal(value float64, decimals int) string {
+	return strings.Replace(strconv.FormatFloat(value, 'f', decimals, 64), ".", ",", 1)
+}
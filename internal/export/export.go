@@ -0,0 +1,71 @@
+package export
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+
+	"analytics-service/internal/analytics"
+)
+
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+
+	ContentTypeCSV  = "text/csv; charset=utf-8"
+	ContentTypeXLSX = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+// column describes one exported field of ItemAnalyticsResult. Exactly one of
+// text or number is set.
+type column struct {
+	header   string
+	text     func(*analytics.ItemAnalyticsResult) string
+	number   func(*analytics.ItemAnalyticsResult) float64
+	decimals int
+}
+
+var itemColumns = []column{
+	{header: "Код", text: func(i *analytics.ItemAnalyticsResult) string { return i.Code }},
+	{header: "Наименование", text: func(i *analytics.ItemAnalyticsResult) string { return i.Name }},
+	{header: "Группа", text: func(i *analytics.ItemAnalyticsResult) string { return i.Group }},
+	{header: "Продажи, руб.", number: func(i *analytics.ItemAnalyticsResult) float64 { return i.Sales }, decimals: 2},
+	{header: "Количество", number: func(i *analytics.ItemAnalyticsResult) float64 { return i.Quantity }, decimals: 3},
+	{header: "Потери, руб.", number: func(i *analytics.ItemAnalyticsResult) float64 { return i.Loss }, decimals: 2},
+	{header: "Потери от продаж, %", number: func(i *analytics.ItemAnalyticsResult) float64 { return i.LossOfProfit }, decimals: 3},
+	{header: "OSA, %", number: func(i *analytics.ItemAnalyticsResult) float64 { return i.OSA }, decimals: 2},
+	{header: "ABC", text: func(i *analytics.ItemAnalyticsResult) string { return i.ABC }},
+	{header: "XYZ", text: func(i *analytics.ItemAnalyticsResult) string { return i.XYZ }},
+}
+
+var groupHeaders = []string{"Группа", "Товаров", "Продажи, руб.", "Потери, руб.", "Потери от продаж, %", "OSA, %"}
+
+// Negotiate picks the export format from the explicit request field first and
+// the Accept header second. Unknown Accept values fall back to JSON.
+func Negotiate(format, accept string) (string, error) {
+	switch strings.ToLower(format) {
+	case "":
+	case FormatJSON, FormatCSV, FormatXLSX:
+		return strings.ToLower(format), nil
+	default:
+		return "", fmt.Errorf("unknown Format %q, expected json, csv or xlsx", format)
+	}
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "text/csv":
+			return FormatCSV, nil
+		case ContentTypeXLSX:
+			return FormatXLSX, nil
+		case "application/json":
+			return FormatJSON, nil
+		}
+	}
+
+	return FormatJSON, nil
+}
@@ -0,0 +1,128 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	"analytics-service/internal/analytics"
+)
+
+func testItems() []analytics.ItemAnalyticsResult {
+	return []analytics.ItemAnalyticsResult{
+		{Code: "1001", Name: "Молоко; 3,2%", Group: "Молочные", Sales: 1234.5, Quantity: 10.25, Loss: 12.3, LossOfProfit: 0.996, OSA: 87.5, ABC: "A", XYZ: "X"},
+		{Code: "1002", Name: "Хлеб <белый> & чёрный", Group: "Хлеб", Sales: 300, Quantity: 3, ABC: "B", XYZ: "Z"},
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		format string
+		accept string
+		want   string
+	}{
+		{"", "", FormatJSON},
+		{"", "*/*", FormatJSON},
+		{"", "text/csv", FormatCSV},
+		{"", "text/html, text/csv;q=0.9", FormatCSV},
+		{"", ContentTypeXLSX, FormatXLSX},
+		{"CSV", "application/json", FormatCSV},
+		{"json", "text/csv", FormatJSON},
+	}
+
+	for _, tt := range tests {
+		got, err := Negotiate(tt.format, tt.accept)
+		if err != nil {
+			t.Fatalf("Negotiate(%q, %q) failed: %v", tt.format, tt.accept, err)
+		}
+		if got != tt.want {
+			t.Errorf("Negotiate(%q, %q) = %q, want %q", tt.format, tt.accept, got, tt.want)
+		}
+	}
+
+	if _, err := Negotiate("pdf", ""); err == nil {
+		t.Fatal("Expected error for unknown format")
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, testItems()); err != nil {
+		t.Fatalf("WriteCSV failed: %v", err)
+	}
+
+	out := buf.String()
+	if !strings.HasPrefix(out, utf8BOM) {
+		t.Fatal("Expected CSV to start with a UTF-8 BOM")
+	}
+
+	lines := strings.Split(strings.TrimSuffix(strings.TrimPrefix(out, utf8BOM), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected header and 2 rows, got %d lines", len(lines))
+	}
+
+	if !strings.HasPrefix(lines[0], "Код;Наименование;Группа;Продажи, руб.;") {
+		t.Errorf("Unexpected header: %q", lines[0])
+	}
+
+	want := `1001;"Молоко; 3,2%";Молочные;1234,50;10,250;12,30;0,996;87,50;A;X`
+	if lines[1] != want {
+		t.Errorf("Expected row %q, got %q", want, lines[1])
+	}
+}
+
+func TestWriteXLSX(t *testing.T) {
+	items := testItems()
+
+	var buf bytes.Buffer
+	if err := WriteXLSX(&buf, items, analytics.AggregateGroups(items)); err != nil {
+		t.Fatalf("WriteXLSX failed: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Workbook is not a valid zip: %v", err)
+	}
+
+	parts := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", f.Name, err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		parts[f.Name] = string(data)
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml", "xl/worksheets/sheet2.xml"} {
+		content, ok := parts[name]
+		if !ok {
+			t.Fatalf("Workbook is missing %s", name)
+		}
+		if err := xml.Unmarshal([]byte(content), new(struct{})); err != nil {
+			t.Errorf("%s is not well-formed XML: %v", name, err)
+		}
+	}
+
+	if !strings.Contains(parts["xl/worksheets/sheet1.xml"], "Хлеб &lt;белый&gt; &amp; чёрный") {
+		t.Error("Expected item names to be XML-escaped on the items sheet")
+	}
+	if !strings.Contains(parts["xl/worksheets/sheet1.xml"], `<c r="D2" s="2"><v>1234.5</v></c>`) {
+		t.Error("Expected sales as a numeric cell on the items sheet")
+	}
+	if !strings.Contains(parts["xl/worksheets/sheet2.xml"], "Молочные") {
+		t.Error("Expected group summary sheet to list Молочные")
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	for n, want := range map[int]string{1: "A", 26: "Z", 27: "AA", 52: "AZ", 703: "AAA"} {
+		if got := columnName(n); got != want {
+			t.Errorf("columnName(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"analytics-service/internal/analytics"
+)
+
+// Cell styles defined in xlsxStyles, referenced by index.
+const (
+	styleDefault = iota
+	styleHeader
+	styleMoney
+	styleDecimal3
+	styleInteger
+)
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+<Override PartName="/xl/worksheets/sheet2.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>`
+
+const xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+
+const xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets>
+<sheet name="Товары" sheetId="1" r:id="rId1"/>
+<sheet name="Группы" sheetId="2" r:id="rId2"/>
+</sheets>
+</workbook>`
+
+const xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet2.xml"/>
+<Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+</Relationships>`
+
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="1"><numFmt numFmtId="164" formatCode="#,##0.000"/></numFmts>
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="5">
+<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>
+<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>
+<xf numFmtId="4" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="1" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+</cellXfs>
+</styleSheet>`
+
+// WriteXLSX streams a workbook with the item rows on the first sheet and a
+// per-group summary on the second.
+func WriteXLSX(w io.Writer, items []analytics.ItemAnalyticsResult, groups []analytics.GroupAnalyticsResult) error {
+	zw := zip.NewWriter(w)
+
+	static := []struct{ name, content string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, part := range static {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return err
+		}
+	}
+
+	if err := writeSheet(zw, "xl/worksheets/sheet1.xml", func(sw *sheetWriter) {
+		sw.startRow()
+		for _, col := range itemColumns {
+			sw.text(col.header, styleHeader)
+		}
+		sw.endRow()
+
+		for i := range items {
+			sw.startRow()
+			for _, col := range itemColumns {
+				if col.text != nil {
+					sw.text(col.text(&items[i]), styleDefault)
+				} else {
+					sw.number(col.number(&items[i]), decimalStyle(col.decimals))
+				}
+			}
+			sw.endRow()
+		}
+	}); err != nil {
+		return err
+	}
+
+	labels := abcLabels(groups)
+	if err := writeSheet(zw, "xl/worksheets/sheet2.xml", func(sw *sheetWriter) {
+		sw.startRow()
+		for _, header := range groupHeaders {
+			sw.text(header, styleHeader)
+		}
+		for _, label := range labels {
+			sw.text(label, styleHeader)
+		}
+		sw.endRow()
+
+		for _, group := range groups {
+			sw.startRow()
+			sw.text(group.Group, styleDefault)
+			sw.number(float64(group.Items), styleInteger)
+			sw.number(group.Sales, styleMoney)
+			sw.number(group.Loss, styleMoney)
+			sw.number(group.LossOfProfit, styleDecimal3)
+			sw.number(group.OSA, styleMoney)
+			for _, label := range labels {
+				sw.number(float64(group.ABC[label]), styleInteger)
+			}
+			sw.endRow()
+		}
+	}); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+func decimalStyle(decimals int) int {
+	if decimals > 2 {
+		return styleDecimal3
+	}
+	return styleMoney
+}
+
+func abcLabels(groups []analytics.GroupAnalyticsResult) []string {
+	seen := map[string]bool{"A": true, "B": true, "C": true}
+	for _, group := range groups {
+		for label := range group.ABC {
+			seen[label] = true
+		}
+	}
+
+	labels := make([]string, 0, len(seen))
+	for label := range seen {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+type sheetWriter struct {
+	w   *bufio.Writer
+	row int
+	col int
+}
+
+func writeSheet(zw *zip.Writer, name string, fill func(*sheetWriter)) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+
+	sw := &sheetWriter{w: bufio.NewWriter(f)}
+	sw.w.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	sw.w.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	fill(sw)
+	sw.w.WriteString(`</sheetData></worksheet>`)
+	return sw.w.Flush()
+}
+
+func (sw *sheetWriter) startRow() {
+	sw.row++
+	sw.col = 0
+	fmt.Fprintf(sw.w, `<row r="%d">`, sw.row)
+}
+
+func (sw *sheetWriter) endRow() {
+	sw.w.WriteString(`</row>`)
+}
+
+func (sw *sheetWriter) text(value string, style int) {
+	fmt.Fprintf(sw.w, `<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">`, sw.nextRef(), style)
+	xml.EscapeText(sw.w, []byte(value))
+	sw.w.WriteString(`</t></is></c>`)
+}
+
+func (sw *sheetWriter) number(value float64, style int) {
+	fmt.Fprintf(sw.w, `<c r="%s" s="%d"><v>%s</v></c>`, sw.nextRef(), style, strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+func (sw *sheetWriter) nextRef() string {
+	sw.col++
+	return columnName(sw.col) + strconv.Itoa(sw.row)
+}
+
+// columnName converts a 1-based column index to its spreadsheet letters.
+func columnName(n int) string {
+	name := ""
+	for n > 0 {
+		n--
+		name = string(rune('A'+n%26)) + name
+		n /= 26
+	}
+	return name
+}
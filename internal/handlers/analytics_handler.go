@@ -2,26 +2,40 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"time"
 
 	"analytics-service/internal/analytics"
+	"analytics-service/internal/audit"
 	"analytics-service/internal/auth"
+	"analytics-service/internal/export"
+	"analytics-service/internal/userdb"
+
+	"github.com/gorilla/mux"
 )
 
+// AnalyticsHandler serves each tenant from its own analytics.Service. The
+// service passed to NewAnalyticsHandler reads the shared dumps and belongs to
+// the default tenant.
 type AnalyticsHandler struct {
-	analyticsService *analytics.Service
-	authService      *auth.Service
+	tenants     map[string]*analytics.Service
+	authService *auth.Service
 }
 
 func NewAnalyticsHandler(analyticsService *analytics.Service, authService *auth.Service) *AnalyticsHandler {
 	return &AnalyticsHandler{
-		analyticsService: analyticsService,
-		authService:      authService,
+		tenants:     map[string]*analytics.Service{userdb.DefaultTenant: analyticsService},
+		authService: authService,
 	}
 }
 
+func (h *AnalyticsHandler) SetTenantService(tenant string, analyticsService *analytics.Service) {
+	h.tenants[tenant] = analyticsService
+}
+
 func (h *AnalyticsHandler) GetItemAnalytics(w http.ResponseWriter, r *http.Request) {
 	startTime := time.Now()
 
@@ -31,32 +45,230 @@ func (h *AnalyticsHandler) GetItemAnalytics(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	if req.Token == "" || req.StartDate == "" || req.FinishDate == "" {
-		http.Error(w, "Token, StartDate and FinishDate are required", http.StatusBadRequest)
+	if req.StartDate == "" || req.FinishDate == "" {
+		http.Error(w, "StartDate and FinishDate are required", http.StatusBadRequest)
 		return
 	}
 
-	validateResponse, err := h.authService.ValidateToken(req.Token)
+	format, err := export.Negotiate(req.Format, r.Header.Get("Accept"))
 	if err != nil {
-		http.Error(w, "Failed to validate token", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	// A file is the whole report: every filtered row, and a group sheet that
+	// agrees with totals. Pages only make sense for the JSON view.
+	if format != export.FormatJSON {
+		req.Offset, req.Limit = 0, 0
+	}
 
-	if !validateResponse.Valid {
-		http.Error(w, "Invalid token", http.StatusUnauthorized)
+	service, ok := h.authorize(w, r, req.Token)
+	if !ok {
 		return
 	}
+	annotateAudit(r, req.StartDate, req.FinishDate, itemAuditFilters(&req))
 
-	response, err := h.analyticsService.GetItemAnalytics(&req)
+	response, err := service.GetItemAnalytics(&req)
 	if err != nil {
-		http.Error(w, "Failed to process analytics", http.StatusInternalServerError)
+		writeAnalyticsError(w, err)
 		return
 	}
+	auditResults(r, len(response.Items))
 
 	processingTime := time.Since(startTime)
 	log.Printf("Analytics request processed in %v", processingTime)
 
+	if format != export.FormatJSON {
+		writeExport(w, format, &req, response.Items)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *AnalyticsHandler) GetTimeSeries(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	var req analytics.TimeSeriesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.StartDate == "" || req.FinishDate == "" {
+		http.Error(w, "StartDate and FinishDate are required", http.StatusBadRequest)
+		return
+	}
+
+	service, ok := h.authorize(w, r, req.Token)
+	if !ok {
+		return
+	}
+
+	annotateAudit(r, req.StartDate, req.FinishDate, struct {
+		Interval string   `json:"Interval,omitempty"`
+		Codes    []string `json:"Codes,omitempty"`
+	}{req.Interval, req.Codes})
+
+	response, err := service.GetTimeSeries(&req)
+	if err != nil {
+		writeAnalyticsError(w, err)
+		return
+	}
+	auditResults(r, len(response.Items))
+
+	processingTime := time.Since(startTime)
+	log.Printf("Time series request processed in %v", processingTime)
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *AnalyticsHandler) GetGroupAnalytics(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	var req analytics.ItemAnalyticsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.StartDate == "" || req.FinishDate == "" {
+		http.Error(w, "StartDate and FinishDate are required", http.StatusBadRequest)
+		return
+	}
+
+	service, ok := h.authorize(w, r, req.Token)
+	if !ok {
+		return
+	}
+
+	annotateAudit(r, req.StartDate, req.FinishDate, itemAuditFilters(&req))
+
+	response, err := service.GetGroupAnalytics(&req)
+	if err != nil {
+		writeAnalyticsError(w, err)
+		return
+	}
+	auditResults(r, len(response.Groups))
+
+	processingTime := time.Since(startTime)
+	log.Printf("Group analytics request processed in %v", processingTime)
+
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
+
+// Reload re-reads the caller's tenant dataset without waiting for the next
+// reload tick.
+func (h *AnalyticsHandler) Reload(w http.ResponseWriter, r *http.Request) {
+	service, ok := h.authorize(w, r, r.URL.Query().Get("token"))
+	if !ok {
+		return
+	}
+
+	if err := service.Reload(); err != nil {
+		writeAnalyticsError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UploadData replaces the stock or sales dump of the caller's tenant with the
+// request body. The body is the dump itself, so the token goes in the
+// Authorization header or, while token parameters are allowed, the query.
+func (h *AnalyticsHandler) UploadData(w http.ResponseWriter, r *http.Request) {
+	service, ok := h.authorize(w, r, r.URL.Query().Get("token"))
+	if !ok {
+		return
+	}
+
+	kind := mux.Vars(r)["kind"]
+	if err := service.ReplaceData(kind, r.Body); err != nil {
+		writeAnalyticsError(w, err)
+		return
+	}
+
+	log.Printf("Replaced %s dump", kind)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorize resolves the caller to its tenant's service, using what the auth
+// middleware put in the context when it ran and token otherwise. Tenants without a
+// dataset are refused rather than falling back to the shared dumps.
+func (h *AnalyticsHandler) authorize(w http.ResponseWriter, r *http.Request, token string) (*analytics.Service, bool) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		if contextual, found := contextToken(r); found {
+			token = contextual
+		}
+		principal, ok = h.authService.Authenticate(token)
+	}
+	if !ok {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return nil, false
+	}
+	if event, tracked := audit.EventFromContext(r.Context()); tracked && event.Principal == "" {
+		*event = auditEvent(r, event.Type, principal)
+	}
+
+	service, ok := h.tenants[principal.Tenant]
+	if !ok || principal.Tenant == "" {
+		log.Printf("User %d has no dataset for tenant %q", principal.UserID, principal.Tenant)
+		http.Error(w, "No analytics data for this account", http.StatusForbidden)
+		return nil, false
+	}
+
+	return service, true
+}
+
+// itemAuditFilters is what the audit log keeps of an item request besides
+// its dates: everything that decides which rows were returned.
+func itemAuditFilters(req *analytics.ItemAnalyticsRequest) interface{} {
+	return struct {
+		ABC       *analytics.ABCOptions `json:"ABC,omitempty"`
+		XYZ       *analytics.XYZOptions `json:"XYZ,omitempty"`
+		Filter    *analytics.ItemFilter `json:"Filter,omitempty"`
+		SortBy    string                `json:"SortBy,omitempty"`
+		SortOrder string                `json:"SortOrder,omitempty"`
+		Offset    int                   `json:"Offset,omitempty"`
+		Limit     int                   `json:"Limit,omitempty"`
+		Format    string                `json:"Format,omitempty"`
+	}{req.ABC, req.XYZ, req.Filter, req.SortBy, req.SortOrder, req.Offset, req.Limit, req.Format}
+}
+
+func writeExport(w http.ResponseWriter, format string, req *analytics.ItemAnalyticsRequest, items []analytics.ItemAnalyticsResult) {
+	filename := fmt.Sprintf("analytics_%s-%s.%s", req.StartDate, req.FinishDate, format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	var err error
+	switch format {
+	case export.FormatCSV:
+		w.Header().Set("Content-Type", export.ContentTypeCSV)
+		w.WriteHeader(http.StatusOK)
+		err = export.WriteCSV(w, items)
+	case export.FormatXLSX:
+		w.Header().Set("Content-Type", export.ContentTypeXLSX)
+		w.WriteHeader(http.StatusOK)
+		err = export.WriteXLSX(w, items, analytics.AggregateGroups(items))
+	}
+
+	if err != nil {
+		log.Printf("Failed to write %s export: %v", format, err)
+	}
+}
+
+func writeAnalyticsError(w http.ResponseWriter, err error) {
+	var validationErr *analytics.ValidationError
+	if errors.As(err, &validationErr) {
+		http.Error(w, validationErr.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("Analytics error: %v", err)
+	http.Error(w, "Failed to process analytics", http.StatusInternalServerError)
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"analytics-service/internal/audit"
+	"analytics-service/internal/auth"
+	"analytics-service/internal/userdb"
+
+	"github.com/gorilla/mux"
+)
+
+// APIKeyHandler manages API keys. Its routes sit behind the admin permission,
+// so the caller's principal is always in the request context.
+type APIKeyHandler struct {
+	authService *auth.Service
+	auditLog    *audit.Log
+}
+
+func NewAPIKeyHandler(authService *auth.Service) *APIKeyHandler {
+	return &APIKeyHandler{
+		authService: authService,
+		auditLog:    audit.NewLog(),
+	}
+}
+
+// SetAuditLog sets where created and revoked keys are recorded.
+func (h *APIKeyHandler) SetAuditLog(auditLog *audit.Log) {
+	if auditLog != nil {
+		h.auditLog = auditLog
+	}
+}
+
+func (h *APIKeyHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	creator, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	var req auth.CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.authService.CreateAPIKey(&req, creator)
+	if errors.Is(err, auth.ErrInvalidAPIKey) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("API key error: %v", err)
+		http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("%s created API key %s (%s)", creator, response.ID, response.Name)
+
+	event := auditEvent(r, audit.APIKeyCreated, creator)
+	event.Status = http.StatusCreated
+	event.Detail = fmt.Sprintf("%s (%s) for tenant %s", response.ID, response.Name, response.Tenant)
+	h.auditLog.Record(event)
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *APIKeyHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(h.authService.ListAPIKeys())
+}
+
+func (h *APIKeyHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	err := h.authService.RevokeAPIKey(id)
+	if errors.Is(err, userdb.ErrAPIKeyNotFound) {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("API key error: %v", err)
+		http.Error(w, "Failed to revoke API key", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Revoked API key %s", id)
+
+	admin, _ := auth.PrincipalFromContext(r.Context())
+	event := auditEvent(r, audit.APIKeyRevoked, admin)
+	event.Status = http.StatusNoContent
+	event.Detail = id
+	h.auditLog.Record(event)
+	w.WriteHeader(http.StatusNoContent)
+}
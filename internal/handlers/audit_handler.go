@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"analytics-service/internal/audit"
+	"analytics-service/internal/auth"
+)
+
+// AuditHandler records analytics requests to the audit log and serves
+// queries over it.
+type AuditHandler struct {
+	auditLog *audit.Log
+}
+
+func NewAuditHandler(auditLog *audit.Log) *AuditHandler {
+	return &AuditHandler{
+		auditLog: auditLog,
+	}
+}
+
+// Track records every request that passes through it, with the status and
+// duration of the response. It runs after the auth middleware, so the
+// principal is in the context; handlers add the date range, filters and
+// result count through audit.EventFromContext.
+func (h *AuditHandler) Track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		startTime := time.Now()
+
+		principal, _ := auth.PrincipalFromContext(r.Context())
+		event := auditEvent(r, audit.Analytics, principal)
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(recorder, r.WithContext(audit.WithEvent(r.Context(), &event)))
+
+		event.Status = recorder.status
+		event.DurationMS = float64(time.Since(startTime).Microseconds()) / 1000
+		h.auditLog.Record(event)
+	})
+}
+
+// Query answers GET /admin/audit. Every parameter is optional: type,
+// user_id, api_key, tenant, from and to (RFC 3339, event time), covers (a
+// report date, DD.MM.YYYY) and limit (default 100, at most 1000).
+func (h *AuditHandler) Query(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q := audit.Query{
+		Type:     params.Get("type"),
+		APIKeyID: params.Get("api_key"),
+		Tenant:   params.Get("tenant"),
+	}
+
+	var err error
+	if value := params.Get("user_id"); value != "" {
+		if q.UserID, err = strconv.Atoi(value); err != nil {
+			http.Error(w, "user_id must be a number", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := params.Get("limit"); value != "" {
+		if q.Limit, err = strconv.Atoi(value); err != nil {
+			http.Error(w, "limit must be a number", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := params.Get("from"); value != "" {
+		if q.From, err = time.Parse(time.RFC3339, value); err != nil {
+			http.Error(w, "from must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := params.Get("to"); value != "" {
+		if q.To, err = time.Parse(time.RFC3339, value); err != nil {
+			http.Error(w, "to must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := params.Get("covers"); value != "" {
+		if q.Covers, err = audit.ParseReportDate(value); err != nil {
+			http.Error(w, "covers must be a DD.MM.YYYY date", http.StatusBadRequest)
+			return
+		}
+	}
+
+	events, err := h.auditLog.Query(q)
+	if err != nil {
+		log.Printf("Audit query error: %v", err)
+		http.Error(w, "Failed to read audit log", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(events)
+}
+
+// auditEvent starts an event about a request; principal may be nil for
+// callers that could not be identified.
+func auditEvent(r *http.Request, eventType string, principal *auth.Principal) audit.Event {
+	event := audit.Event{
+		Type:   eventType,
+		IP:     remoteIP(r),
+		Method: r.Method,
+		Path:   r.URL.Path,
+	}
+	if principal != nil {
+		event.Principal = principal.String()
+		event.UserID = principal.UserID
+		event.APIKeyID = principal.APIKeyID
+		event.Email = principal.Email
+		event.Tenant = principal.Tenant
+	}
+	return event
+}
+
+// annotateAudit adds an analytics request's parameters to the event Track
+// records for it.
+func annotateAudit(r *http.Request, startDate, finishDate string, filters interface{}) {
+	event, ok := audit.EventFromContext(r.Context())
+	if !ok {
+		return
+	}
+
+	event.StartDate = startDate
+	event.FinishDate = finishDate
+	if data, err := json.Marshal(filters); err == nil && string(data) != "{}" {
+		event.Filters = data
+	}
+}
+
+func auditResults(r *http.Request, results int) {
+	if event, ok := audit.EventFromContext(r.Context()); ok {
+		event.Results = &results
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
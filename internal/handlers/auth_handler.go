@@ -2,18 +2,43 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
+	"analytics-service/internal/audit"
 	"analytics-service/internal/auth"
+	"analytics-service/internal/userdb"
 )
 
 type AuthHandler struct {
 	authService *auth.Service
+	limiter     *auth.LoginLimiter
+	auditLog    *audit.Log
 }
 
 func NewAuthHandler(authService *auth.Service) *AuthHandler {
 	return &AuthHandler{
 		authService: authService,
+		limiter:     auth.NewLoginLimiter(),
+		auditLog:    audit.NewLog(),
+	}
+}
+
+// SetAuditLog sets where issued tokens and failed logins are recorded.
+func (h *AuthHandler) SetAuditLog(auditLog *audit.Log) {
+	if auditLog != nil {
+		h.auditLog = auditLog
+	}
+}
+
+// SetLoginLimiter replaces the default limits on password checks.
+func (h *AuthHandler) SetLoginLimiter(limiter *auth.LoginLimiter) {
+	if limiter != nil {
+		h.limiter = limiter
 	}
 }
 
@@ -29,13 +54,214 @@ func (h *AuthHandler) GenerateToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !h.allowLogin(w, r, req.Email) {
+		return
+	}
+
 	response, err := h.authService.GenerateToken(&req)
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		h.loginFailed(r, req.Email)
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
 	if err != nil {
+		h.limiter.Release(remoteIP(r), req.Email)
 		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
 		return
 	}
+	h.limiter.Success(remoteIP(r), req.Email)
+	h.auditIssued(r, response, "login")
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req auth.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.RefreshToken == "" {
+		http.Error(w, "refresh_token is required", http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.authService.Refresh(&req)
+	if errors.Is(err, auth.ErrInvalidToken) {
+		event := auditEvent(r, audit.TokenRejected, nil)
+		event.Status = http.StatusUnauthorized
+		event.Detail = "refresh token"
+		h.auditLog.Record(event)
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Printf("Refresh error: %v", err)
+		http.Error(w, "Failed to refresh token", http.StatusInternalServerError)
+		return
+	}
+	h.auditIssued(r, response, "refresh")
 
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
+
+// PublicKeys serves the JWKS other services verify tokens with. It lists
+// only RS256 and EdDSA keys; with HMAC keys alone the set is empty.
+func (h *AuthHandler) PublicKeys(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(h.authService.PublicKeys())
+}
+
+func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
+	var req auth.AuthRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Email == "" || req.Password == "" {
+		http.Error(w, "Email and password are required", http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.authService.Register(&req)
+	if err != nil {
+		writeAccountError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req auth.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Email == "" || req.Password == "" || req.NewPassword == "" {
+		http.Error(w, "Email, password and new_password are required", http.StatusBadRequest)
+		return
+	}
+
+	if !h.allowLogin(w, r, req.Email) {
+		return
+	}
+
+	if err := h.authService.ChangePassword(&req); err != nil {
+		h.accountFailed(r, req.Email, err)
+		writeAccountError(w, err)
+		return
+	}
+	h.limiter.Success(remoteIP(r), req.Email)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AuthHandler) DisableAccount(w http.ResponseWriter, r *http.Request) {
+	var req auth.AuthRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Email == "" || req.Password == "" {
+		http.Error(w, "Email and password are required", http.StatusBadRequest)
+		return
+	}
+
+	if !h.allowLogin(w, r, req.Email) {
+		return
+	}
+
+	if err := h.authService.DisableAccount(&req); err != nil {
+		h.accountFailed(r, req.Email, err)
+		writeAccountError(w, err)
+		return
+	}
+	h.limiter.Success(remoteIP(r), req.Email)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// allowLogin answers 429 with Retry-After while the client's IP or the
+// account is locked out after failed password checks. An allowed attempt
+// holds a slot in the limiter until loginFailed, accountFailed or
+// limiter.Success ends it.
+func (h *AuthHandler) allowLogin(w http.ResponseWriter, r *http.Request, email string) bool {
+	wait := h.limiter.Check(remoteIP(r), email)
+	if wait == 0 {
+		return true
+	}
+
+	log.Printf("security: refused login for %q from %s, locked out for %s", email, remoteIP(r), wait.Round(time.Second))
+	event := auditEvent(r, audit.LoginFailed, nil)
+	event.Email = email
+	event.Status = http.StatusTooManyRequests
+	event.Detail = "locked out"
+	h.auditLog.Record(event)
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, "Too many failed attempts", http.StatusTooManyRequests)
+	return false
+}
+
+// loginFailed counts a wrong password and writes the security log entry
+// failed attempts are reviewed from.
+func (h *AuthHandler) loginFailed(r *http.Request, email string) {
+	ip := remoteIP(r)
+	wait, counts := h.limiter.Failure(ip, email)
+
+	event := auditEvent(r, audit.LoginFailed, nil)
+	event.Email = email
+	event.Status = http.StatusUnauthorized
+	h.auditLog.Record(event)
+
+	if wait == 0 {
+		log.Printf("security: failed login for %q from %s (%d in a row for the account, %d for the IP)", email, ip, counts.Account, counts.IP)
+		return
+	}
+	log.Printf("security: failed login for %q from %s (%d in a row for the account, %d for the IP), locked out for %s", email, ip, counts.Account, counts.IP, wait)
+}
+
+// auditIssued records a new token pair under the principal it was issued
+// to.
+func (h *AuthHandler) auditIssued(r *http.Request, response *auth.AuthResponse, detail string) {
+	principal, _ := h.authService.Authenticate(response.Token)
+	event := auditEvent(r, audit.TokenIssued, principal)
+	event.Status = http.StatusOK
+	event.Detail = detail
+	h.auditLog.Record(event)
+}
+
+// accountFailed ends an attempt on an account endpoint: a wrong password
+// counts as a failed login, any other error does not.
+func (h *AuthHandler) accountFailed(r *http.Request, email string, err error) {
+	if errors.Is(err, userdb.ErrInvalidCredentials) || errors.Is(err, userdb.ErrUserNotFound) {
+		h.loginFailed(r, email)
+		return
+	}
+	h.limiter.Release(remoteIP(r), email)
+}
+
+func writeAccountError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, userdb.ErrInvalidCredentials), errors.Is(err, userdb.ErrUserNotFound):
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+	case errors.Is(err, userdb.ErrUserExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, userdb.ErrInvalidEmail), errors.Is(err, userdb.ErrWeakPassword), errors.Is(err, userdb.ErrLongPassword):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("Account error: %v", err)
+		http.Error(w, "Failed to update account", http.StatusInternalServerError)
+	}
+}
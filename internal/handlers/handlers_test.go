@@ -5,16 +5,33 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"analytics-service/internal/analytics"
+	"analytics-service/internal/audit"
 	"analytics-service/internal/auth"
 	"analytics-service/internal/userdb"
+
+	"github.com/gorilla/mux"
 )
 
+func newTestUsers(t *testing.T) *userdb.UserStore {
+	t.Helper()
+	users := userdb.NewUserStore()
+	if err := users.AddUser(1, "test@example.com", "password123"); err != nil {
+		t.Fatalf("Failed to add user: %v", err)
+	}
+	return users
+}
+
 func TestAuthHandler_GenerateToken(t *testing.T) {
 	tokenStore := userdb.NewTokenStore()
 	authService := auth.NewService("test-secret", tokenStore)
+	authService.SetUserStore(newTestUsers(t))
 	handler := NewAuthHandler(authService)
 
 
@@ -44,6 +61,162 @@ func TestAuthHandler_GenerateToken(t *testing.T) {
 	}
 }
 
+func TestAuthHandler_IssuedTokenValidates(t *testing.T) {
+	tokenStore := userdb.NewTokenStore()
+	authService := auth.NewService("test-secret", tokenStore)
+	authService.SetUserStore(newTestUsers(t))
+	authHandler := NewAuthHandler(authService)
+	userHandler := NewUserHandler(authService)
+
+
+	bodyBytes, _ := json.Marshal(auth.AuthRequest{Email: "test@example.com", Password: "password123"})
+	req := httptest.NewRequest("POST", "/auth", bytes.NewBuffer(bodyBytes))
+	w := httptest.NewRecorder()
+	authHandler.GenerateToken(w, req)
+	
+	var issued auth.AuthResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &issued); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	
+	if issued.ExpiresAt.IsZero() {
+		t.Fatal("Expected expires_at in the response")
+	}
+	
+
+	req = httptest.NewRequest("GET", "/validate?token="+issued.Token, nil)
+	w = httptest.NewRecorder()
+	userHandler.ValidateToken(w, req)
+	
+	var response auth.ValidateResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	
+	if !response.Valid {
+		t.Fatal("Expected issued token to be valid")
+	}
+}
+
+func TestAuthHandler_GenerateToken_InvalidCredentials(t *testing.T) {
+	tokenStore := userdb.NewTokenStore()
+	authService := auth.NewService("test-secret", tokenStore)
+	authService.SetUserStore(newTestUsers(t))
+	handler := NewAuthHandler(authService)
+
+
+	bodyBytes, _ := json.Marshal(auth.AuthRequest{Email: "test@example.com", Password: "wrong"})
+	req := httptest.NewRequest("POST", "/auth", bytes.NewBuffer(bodyBytes))
+	req.Header.Set("Content-Type", "application/json")
+	
+	w := httptest.NewRecorder()
+	handler.GenerateToken(w, req)
+	
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401, got %d", w.Code)
+	}
+}
+
+func TestAuthHandler_GenerateToken_Lockout(t *testing.T) {
+	tokenStore := userdb.NewTokenStore()
+	authService := auth.NewService("test-secret", tokenStore)
+	authService.SetUserStore(newTestUsers(t))
+	handler := NewAuthHandler(authService)
+
+	limiter := auth.NewLoginLimiter()
+	limiter.SetLimits(2, 100)
+	limiter.SetLockout(time.Minute, time.Hour)
+	handler.SetLoginLimiter(limiter)
+
+
+	login := func(password string) *httptest.ResponseRecorder {
+		bodyBytes, _ := json.Marshal(auth.AuthRequest{Email: "test@example.com", Password: password})
+		req := httptest.NewRequest("POST", "/auth", bytes.NewBuffer(bodyBytes))
+		w := httptest.NewRecorder()
+		handler.GenerateToken(w, req)
+		return w
+	}
+	
+	for i := 0; i < 2; i++ {
+		if w := login("wrong"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected status 401, got %d", w.Code)
+		}
+	}
+	
+
+	w := login("password123")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status 429 even with the right password, got %d", w.Code)
+	}
+	
+	if retryAfter := w.Header().Get("Retry-After"); retryAfter != "60" {
+		t.Fatalf("Expected Retry-After 60, got %q", retryAfter)
+	}
+}
+
+func TestAuthHandler_AccountLifecycle(t *testing.T) {
+	tokenStore := userdb.NewTokenStore()
+	authService := auth.NewService("test-secret", tokenStore)
+	authService.SetLegacyTokens(false)
+	handler := NewAuthHandler(authService)
+
+	post := func(handle http.HandlerFunc, body interface{}) *httptest.ResponseRecorder {
+		bodyBytes, _ := json.Marshal(body)
+		req := httptest.NewRequest("POST", "/", bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handle(w, req)
+		return w
+	}
+
+
+	credentials := auth.AuthRequest{Email: "new@example.com", Password: "password123"}
+	
+	if w := post(handler.GenerateToken, credentials); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 before registration, got %d", w.Code)
+	}
+	
+	if w := post(handler.Register, credentials); w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 on registration, got %d", w.Code)
+	}
+	
+	if w := post(handler.Register, credentials); w.Code != http.StatusConflict {
+		t.Fatalf("Expected 409 on duplicate registration, got %d", w.Code)
+	}
+	
+	if w := post(handler.Register, auth.AuthRequest{Email: "weak@example.com", Password: "short"}); w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 on weak password, got %d", w.Code)
+	}
+	
+	if w := post(handler.Register, auth.AuthRequest{Email: "long@example.com", Password: strings.Repeat("p", 80)}); w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 on a password over 72 bytes, got %d", w.Code)
+	}
+	
+	if w := post(handler.GenerateToken, credentials); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 after registration, got %d", w.Code)
+	}
+	
+
+	change := auth.ChangePasswordRequest{Email: credentials.Email, Password: credentials.Password, NewPassword: "changed-password"}
+	if w := post(handler.ChangePassword, change); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204 on password change, got %d", w.Code)
+	}
+	
+	if w := post(handler.GenerateToken, credentials); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected old password to be rejected, got %d", w.Code)
+	}
+	
+
+	credentials.Password = "changed-password"
+	if w := post(handler.DisableAccount, credentials); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204 on disable, got %d", w.Code)
+	}
+	
+	if w := post(handler.GenerateToken, credentials); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected disabled account to be rejected, got %d", w.Code)
+	}
+}
+
 func TestAuthHandler_GenerateToken_InvalidRequest(t *testing.T) {
 	tokenStore := userdb.NewTokenStore()
 	authService := auth.NewService("test-secret", tokenStore)
@@ -151,10 +324,86 @@ func TestUserHandler_ValidateToken_InvalidToken(t *testing.T) {
 	}
 }
 
+func TestUserHandler_Logout(t *testing.T) {
+	tokenStore := userdb.NewTokenStore()
+	authService := auth.NewService("test-secret", tokenStore)
+	handler := NewUserHandler(authService)
+
+
+	testToken := "test-token-123"
+	tokenStore.AddToken(testToken, 1)
+
+
+	bodyBytes, _ := json.Marshal(auth.LogoutRequest{Token: testToken})
+	req := httptest.NewRequest("POST", "/logout", bytes.NewBuffer(bodyBytes))
+	w := httptest.NewRecorder()
+	handler.Logout(w, req)
+	
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d", w.Code)
+	}
+	
+	if response, _ := authService.ValidateToken(testToken); response.Valid {
+		t.Fatal("Expected token to be invalid after logout")
+	}
+	
+
+	req = httptest.NewRequest("POST", "/logout", bytes.NewBuffer(bodyBytes))
+	w = httptest.NewRecorder()
+	handler.Logout(w, req)
+	
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401 for an already revoked token, got %d", w.Code)
+	}
+}
+
+func TestUserHandler_RevokeUserTokens(t *testing.T) {
+	tokenStore := userdb.NewTokenStore()
+	authService := auth.NewService("test-secret", tokenStore)
+	authService.SetAdmins([]int{9})
+	handler := NewUserHandler(authService)
+
+
+	tokenStore.AddToken("admin-token", 9)
+	tokenStore.AddToken("user-token-1", 1)
+	tokenStore.AddToken("user-token-2", 1)
+
+
+	revoke := func(token string) *httptest.ResponseRecorder {
+		bodyBytes, _ := json.Marshal(auth.RevokeUserRequest{Token: token, UserID: 1})
+		req := httptest.NewRequest("POST", "/admin/tokens/revoke", bytes.NewBuffer(bodyBytes))
+		w := httptest.NewRecorder()
+		handler.RevokeUserTokens(w, req)
+		return w
+	}
+	
+	if w := revoke("user-token-1"); w.Code != http.StatusForbidden {
+		t.Fatalf("Expected status 403 for a non-admin, got %d", w.Code)
+	}
+	
+	w := revoke("admin-token")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	
+	var response auth.RevokeUserResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	
+	if response.Revoked != 2 {
+		t.Fatalf("Expected 2 revoked tokens, got %d", response.Revoked)
+	}
+	
+	if result, _ := authService.ValidateToken("user-token-2"); result.Valid {
+		t.Fatal("Expected user token to be revoked")
+	}
+}
+
 func TestAnalyticsHandler_GetItemAnalytics(t *testing.T) {
 	tokenStore := userdb.NewTokenStore()
 	authService := auth.NewService("test-secret", tokenStore)
-	analyticsService := analytics.NewService()
+	analyticsService := analytics.NewService(&analytics.MemoryDataSource{})
 	handler := NewAnalyticsHandler(analyticsService, authService)
 
 
@@ -184,7 +433,7 @@ func TestAnalyticsHandler_GetItemAnalytics(t *testing.T) {
 func TestAnalyticsHandler_GetItemAnalytics_InvalidToken(t *testing.T) {
 	tokenStore := userdb.NewTokenStore()
 	authService := auth.NewService("test-secret", tokenStore)
-	analyticsService := analytics.NewService()
+	analyticsService := analytics.NewService(&analytics.MemoryDataSource{})
 	handler := NewAnalyticsHandler(analyticsService, authService)
 
 
@@ -209,7 +458,7 @@ func TestAnalyticsHandler_GetItemAnalytics_InvalidToken(t *testing.T) {
 func TestAnalyticsHandler_GetItemAnalytics_MissingFields(t *testing.T) {
 	tokenStore := userdb.NewTokenStore()
 	authService := auth.NewService("test-secret", tokenStore)
-	analyticsService := analytics.NewService()
+	analyticsService := analytics.NewService(&analytics.MemoryDataSource{})
 	handler := NewAnalyticsHandler(analyticsService, authService)
 
 
@@ -233,7 +482,7 @@ func TestAnalyticsHandler_GetItemAnalytics_MissingFields(t *testing.T) {
 func TestAnalyticsHandler_GetItemAnalytics_InvalidJSON(t *testing.T) {
 	tokenStore := userdb.NewTokenStore()
 	authService := auth.NewService("test-secret", tokenStore)
-	analyticsService := analytics.NewService()
+	analyticsService := analytics.NewService(&analytics.MemoryDataSource{})
 	handler := NewAnalyticsHandler(analyticsService, authService)
 
 
@@ -247,3 +496,716 @@ func TestAnalyticsHandler_GetItemAnalytics_InvalidJSON(t *testing.T) {
 		t.Fatalf("Expected status 400, got %d", w.Code)
 	}
 }
+
+func TestAnalyticsHandler_GetTimeSeries(t *testing.T) {
+	tokenStore := userdb.NewTokenStore()
+	authService := auth.NewService("test-secret", tokenStore)
+	analyticsService := analytics.NewService(&analytics.MemoryDataSource{
+		Sales: []analytics.SalesItem{
+			{Код: "1001", Номенклатура: "Товар 1", Период: "02.01.2024 10:00:00", Количество: 1, Сумма: 100},
+		},
+	})
+	handler := NewAnalyticsHandler(analyticsService, authService)
+
+
+	testToken := "test-token-123"
+	tokenStore.AddToken(testToken, 1)
+
+
+	reqBody := analytics.TimeSeriesRequest{
+		Token:      testToken,
+		StartDate:  "01.01.2024",
+		FinishDate: "07.01.2024",
+	}
+	
+	bodyBytes, _ := json.Marshal(reqBody)
+	req := httptest.NewRequest("POST", "/analytics/timeseries", bytes.NewBuffer(bodyBytes))
+	req.Header.Set("Content-Type", "application/json")
+	
+	w := httptest.NewRecorder()
+	handler.GetTimeSeries(w, req)
+	
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	
+	var response analytics.TimeSeriesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	
+	if response.Total != 1 || len(response.Items[0].Points) != 7 {
+		t.Fatalf("Expected 1 item with 7 daily points, got %+v", response)
+	}
+}
+
+func TestAnalyticsHandler_GetTimeSeries_InvalidInterval(t *testing.T) {
+	tokenStore := userdb.NewTokenStore()
+	authService := auth.NewService("test-secret", tokenStore)
+	analyticsService := analytics.NewService(&analytics.MemoryDataSource{})
+	handler := NewAnalyticsHandler(analyticsService, authService)
+
+
+	testToken := "test-token-123"
+	tokenStore.AddToken(testToken, 1)
+
+
+	reqBody := analytics.TimeSeriesRequest{
+		Token:      testToken,
+		StartDate:  "01.01.2024",
+		FinishDate: "31.01.2024",
+		Interval:   "minute",
+	}
+	
+	bodyBytes, _ := json.Marshal(reqBody)
+	req := httptest.NewRequest("POST", "/analytics/timeseries", bytes.NewBuffer(bodyBytes))
+	req.Header.Set("Content-Type", "application/json")
+	
+	w := httptest.NewRecorder()
+	handler.GetTimeSeries(w, req)
+	
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d", w.Code)
+	}
+}
+
+func TestAnalyticsHandler_GetTimeSeries_InvalidToken(t *testing.T) {
+	tokenStore := userdb.NewTokenStore()
+	authService := auth.NewService("test-secret", tokenStore)
+	analyticsService := analytics.NewService(&analytics.MemoryDataSource{})
+	handler := NewAnalyticsHandler(analyticsService, authService)
+
+
+	reqBody := analytics.TimeSeriesRequest{
+		Token:      "invalid-token",
+		StartDate:  "01.01.2024",
+		FinishDate: "31.01.2024",
+	}
+	
+	bodyBytes, _ := json.Marshal(reqBody)
+	req := httptest.NewRequest("POST", "/analytics/timeseries", bytes.NewBuffer(bodyBytes))
+	req.Header.Set("Content-Type", "application/json")
+	
+	w := httptest.NewRecorder()
+	handler.GetTimeSeries(w, req)
+	
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401, got %d", w.Code)
+	}
+}
+
+func TestAnalyticsHandler_GetGroupAnalytics(t *testing.T) {
+	tokenStore := userdb.NewTokenStore()
+	authService := auth.NewService("test-secret", tokenStore)
+	analyticsService := analytics.NewService(&analytics.MemoryDataSource{
+		Stock: []analytics.StockItem{
+			{НоменклатураКод: "1001", Родитель: "Группа 1", Период: "01.01.2024 00:00:00", КонечныйОстаток: 5},
+		},
+		Sales: []analytics.SalesItem{
+			{Код: "1001", Номенклатура: "Товар 1", Период: "02.01.2024 10:00:00", Количество: 1, Сумма: 100},
+			{Код: "1002", Номенклатура: "Товар 2", Период: "02.01.2024 10:00:00", Количество: 1, Сумма: 50},
+		},
+	})
+	handler := NewAnalyticsHandler(analyticsService, authService)
+
+
+	testToken := "test-token-123"
+	tokenStore.AddToken(testToken, 1)
+
+
+	reqBody := analytics.ItemAnalyticsRequest{
+		Token:      testToken,
+		StartDate:  "01.01.2024",
+		FinishDate: "31.01.2024",
+	}
+	
+	bodyBytes, _ := json.Marshal(reqBody)
+	req := httptest.NewRequest("POST", "/analytics/groups", bytes.NewBuffer(bodyBytes))
+	req.Header.Set("Content-Type", "application/json")
+	
+	w := httptest.NewRecorder()
+	handler.GetGroupAnalytics(w, req)
+	
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	
+	var response analytics.GroupAnalyticsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	
+	if response.Total != 2 || response.Groups[0].Group != "Группа 1" {
+		t.Fatalf("Expected 2 groups led by Группа 1, got %+v", response.Groups)
+	}
+}
+
+func TestAnalyticsHandler_GetItemAnalytics_InvalidABCOptions(t *testing.T) {
+	tokenStore := userdb.NewTokenStore()
+	authService := auth.NewService("test-secret", tokenStore)
+	analyticsService := analytics.NewService(&analytics.MemoryDataSource{})
+	handler := NewAnalyticsHandler(analyticsService, authService)
+
+
+	testToken := "test-token-123"
+	tokenStore.AddToken(testToken, 1)
+
+
+	reqBody := analytics.ItemAnalyticsRequest{
+		Token:      testToken,
+		StartDate:  "01.01.2024",
+		FinishDate: "31.01.2024",
+		ABC:        &analytics.ABCOptions{Thresholds: []float64{90, 70}},
+	}
+	
+	bodyBytes, _ := json.Marshal(reqBody)
+	req := httptest.NewRequest("POST", "/analytics", bytes.NewBuffer(bodyBytes))
+	req.Header.Set("Content-Type", "application/json")
+	
+	w := httptest.NewRecorder()
+	handler.GetItemAnalytics(w, req)
+	
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d", w.Code)
+	}
+	
+	if !strings.Contains(w.Body.String(), "ABC.Thresholds") {
+		t.Fatalf("Expected error to explain the bad thresholds, got %q", w.Body.String())
+	}
+}
+
+func TestAnalyticsHandler_GetItemAnalytics_CSV(t *testing.T) {
+	tokenStore := userdb.NewTokenStore()
+	authService := auth.NewService("test-secret", tokenStore)
+	analyticsService := analytics.NewService(&analytics.MemoryDataSource{
+		Sales: []analytics.SalesItem{
+			{Код: "1001", Номенклатура: "Товар 1", Период: "02.01.2024 10:00:00", Количество: 1, Сумма: 100.5},
+			{Код: "1002", Номенклатура: "Товар 2", Период: "03.01.2024 10:00:00", Количество: 1, Сумма: 20},
+		},
+	})
+	handler := NewAnalyticsHandler(analyticsService, authService)
+
+
+	testToken := "test-token-123"
+	tokenStore.AddToken(testToken, 1)
+
+
+	reqBody := analytics.ItemAnalyticsRequest{
+		Token:      testToken,
+		StartDate:  "01.01.2024",
+		FinishDate: "31.01.2024",
+		Offset:     1,
+		Limit:      1,
+	}
+	
+	bodyBytes, _ := json.Marshal(reqBody)
+	req := httptest.NewRequest("POST", "/analytics", bytes.NewBuffer(bodyBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/csv")
+	
+	w := httptest.NewRecorder()
+	handler.GetItemAnalytics(w, req)
+	
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Fatalf("Expected text/csv content type, got %q", ct)
+	}
+	
+	if cd := w.Header().Get("Content-Disposition"); !strings.Contains(cd, "analytics_01.01.2024-31.01.2024.csv") {
+		t.Fatalf("Expected attachment filename, got %q", cd)
+	}
+	
+	if !strings.Contains(w.Body.String(), "1001;Товар 1;") || !strings.Contains(w.Body.String(), "100,50") {
+		t.Fatalf("Expected CSV row for 1001, got %q", w.Body.String())
+	}
+	
+	if !strings.Contains(w.Body.String(), "1002;Товар 2;") {
+		t.Fatalf("Expected the export to ignore Offset/Limit, got %q", w.Body.String())
+	}
+}
+
+func TestAnalyticsHandler_GetItemAnalytics_UnknownFormat(t *testing.T) {
+	tokenStore := userdb.NewTokenStore()
+	authService := auth.NewService("test-secret", tokenStore)
+	analyticsService := analytics.NewService(&analytics.MemoryDataSource{})
+	handler := NewAnalyticsHandler(analyticsService, authService)
+
+
+	testToken := "test-token-123"
+	tokenStore.AddToken(testToken, 1)
+
+
+	reqBody := analytics.ItemAnalyticsRequest{
+		Token:      testToken,
+		StartDate:  "01.01.2024",
+		FinishDate: "31.01.2024",
+		Format:     "pdf",
+	}
+	
+	bodyBytes, _ := json.Marshal(reqBody)
+	req := httptest.NewRequest("POST", "/analytics", bytes.NewBuffer(bodyBytes))
+	req.Header.Set("Content-Type", "application/json")
+	
+	w := httptest.NewRecorder()
+	handler.GetItemAnalytics(w, req)
+	
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d", w.Code)
+	}
+}
+
+func TestAnalyticsHandler_TenantScoping(t *testing.T) {
+	tokenStore := userdb.NewTokenStore()
+	authService := auth.NewService("test-secret", tokenStore)
+	shared := analytics.NewService(&analytics.MemoryDataSource{
+		Sales: []analytics.SalesItem{
+			{Код: "1001", Номенклатура: "Общий товар", Период: "02.01.2024 10:00:00", Количество: 1, Сумма: 100},
+		},
+	})
+	clientB := analytics.NewService(&analytics.MemoryDataSource{
+		Sales: []analytics.SalesItem{
+			{Код: "2001", Номенклатура: "Товар клиента B", Период: "02.01.2024 10:00:00", Количество: 1, Сумма: 50},
+		},
+	})
+	handler := NewAnalyticsHandler(shared, authService)
+	handler.SetTenantService("client-b", clientB)
+
+
+	tokenStore.SaveToken(userdb.TokenRecord{Token: "token-b", UserID: 2, Tenant: "client-b"})
+	tokenStore.SaveToken(userdb.TokenRecord{Token: "token-c", UserID: 3, Tenant: "client-c"})
+	tokenStore.SaveToken(userdb.TokenRecord{Token: "token-none", UserID: 4})
+
+
+	request := func(token string) *httptest.ResponseRecorder {
+		bodyBytes, _ := json.Marshal(analytics.ItemAnalyticsRequest{Token: token, StartDate: "01.01.2024", FinishDate: "31.01.2024"})
+		req := httptest.NewRequest("POST", "/analytics", bytes.NewBuffer(bodyBytes))
+		w := httptest.NewRecorder()
+		handler.GetItemAnalytics(w, req)
+		return w
+	}
+	
+	w := request("token-b")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	
+	var response analytics.AnalyticsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	
+	if response.Total != 1 || response.Items[0].Code != "2001" {
+		t.Fatalf("Expected only client-b data, got %+v", response.Items)
+	}
+	
+
+	for _, token := range []string{"token-c", "token-none"} {
+		if w := request(token); w.Code != http.StatusForbidden {
+			t.Fatalf("Expected status 403 for %s, got %d", token, w.Code)
+		}
+	}
+}
+
+func TestAuthMiddleware_Require(t *testing.T) {
+	tokenStore := userdb.NewTokenStore()
+	authService := auth.NewService("test-secret", tokenStore)
+	middleware := NewAuthMiddleware(authService)
+
+
+	tokenStore.SaveToken(userdb.TokenRecord{Token: "viewer-token", UserID: 2, Tenant: userdb.DefaultTenant, Role: userdb.RoleViewer})
+	tokenStore.SaveToken(userdb.TokenRecord{Token: "analyst-token", UserID: 3, Tenant: userdb.DefaultTenant, Role: userdb.RoleAnalyst})
+
+
+	var seen *auth.Principal
+	var body string
+	handler := middleware.Require(auth.PermExploreAnalytics)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = auth.PrincipalFromContext(r.Context())
+		var req analytics.TimeSeriesRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		body = req.StartDate
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func(token string) *httptest.ResponseRecorder {
+		bodyBytes, _ := json.Marshal(analytics.TimeSeriesRequest{Token: token, StartDate: "01.01.2024", FinishDate: "31.01.2024"})
+		req := httptest.NewRequest("POST", "/analytics/timeseries", bytes.NewBuffer(bodyBytes))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	
+	if w := request("invalid-token"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401, got %d", w.Code)
+	}
+	
+	if w := request("viewer-token"); w.Code != http.StatusForbidden {
+		t.Fatalf("Expected status 403 for a viewer, got %d", w.Code)
+	}
+	
+	if w := request("analyst-token"); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	
+	if seen == nil || seen.UserID != 3 || body != "01.01.2024" {
+		t.Fatalf("Expected principal and body to reach the handler, got %+v and %q", seen, body)
+	}
+}
+
+func TestAnalyticsHandler_UploadData(t *testing.T) {
+	tokenStore := userdb.NewTokenStore()
+	authService := auth.NewService("test-secret", tokenStore)
+	authService.SetAdmins([]int{9})
+
+	dir := t.TempDir()
+	salesPath := filepath.Join(dir, "sales_dump.json")
+	stockPath := filepath.Join(dir, "stock_dump.json")
+	os.WriteFile(salesPath, []byte(`[]`), 0644)
+	os.WriteFile(stockPath, []byte(`[]`), 0644)
+
+	analyticsService := analytics.NewService(analytics.NewFileDataSource(stockPath, salesPath))
+	handler := NewAnalyticsHandler(analyticsService, authService)
+
+	router := mux.NewRouter()
+	adminRoutes := router.PathPrefix("/admin").Subrouter()
+	adminRoutes.Use(NewAuthMiddleware(authService).Require(auth.PermAdmin))
+	adminRoutes.HandleFunc("/data/{kind}", handler.UploadData).Methods("PUT")
+	adminRoutes.HandleFunc("/reload", handler.Reload).Methods("POST")
+
+
+	tokenStore.SaveToken(userdb.TokenRecord{Token: "admin-token", UserID: 9, Tenant: userdb.DefaultTenant})
+	tokenStore.AddToken("user-token", 1)
+
+
+	upload := func(token, kind, content string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/admin/data/"+kind+"?token="+token, strings.NewReader(content))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	sales := `[{"Код": "1001", "Номенклатура": "Товар 1", "Период": "02.01.2024 10:00:00", "Количество": 1, "Сумма": 100}]`
+	
+	if w := upload("user-token", "sales", sales); w.Code != http.StatusForbidden {
+		t.Fatalf("Expected status 403 for a non-admin, got %d", w.Code)
+	}
+	
+	if w := upload("admin-token", "sales", `[{"Код": `); w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 for a malformed dump, got %d", w.Code)
+	}
+	
+	if w := upload("admin-token", "sales", sales); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d", w.Code)
+	}
+	
+	if content, _ := os.ReadFile(salesPath); string(content) != sales {
+		t.Fatalf("Expected uploaded dump on disk, got %s", content)
+	}
+	
+	req := httptest.NewRequest("POST", "/admin/reload?token=admin-token", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d", w.Code)
+	}
+}
+
+func TestAuthMiddleware_BearerToken(t *testing.T) {
+	tokenStore := userdb.NewTokenStore()
+	authService := auth.NewService("test-secret", tokenStore)
+	analyticsService := analytics.NewService(&analytics.MemoryDataSource{})
+	middleware := NewAuthMiddleware(authService)
+	handler := middleware.Require(auth.PermReadAnalytics)(http.HandlerFunc(NewAnalyticsHandler(analyticsService, authService).GetItemAnalytics))
+
+
+	tokenStore.AddToken("test-token-123", 1)
+
+
+	request := func(header, bodyToken string) *httptest.ResponseRecorder {
+		bodyBytes, _ := json.Marshal(analytics.ItemAnalyticsRequest{Token: bodyToken, StartDate: "01.01.2024", FinishDate: "31.01.2024"})
+		req := httptest.NewRequest("POST", "/analytics", bytes.NewBuffer(bodyBytes))
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	
+	w := request("Bearer test-token-123", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for a bearer token, got %d", w.Code)
+	}
+	
+	if w.Header().Get("Deprecation") != "" {
+		t.Fatal("Expected no deprecation header for a bearer token")
+	}
+	
+	if w := request("Bearer invalid-token", "test-token-123"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected the header to take precedence over the body, got %d", w.Code)
+	}
+	
+	w = request("", "test-token-123")
+	if w.Code != http.StatusOK || w.Header().Get("Deprecation") != "true" {
+		t.Fatalf("Expected body token to work with a deprecation header, got %d %q", w.Code, w.Header().Get("Deprecation"))
+	}
+	
+
+	middleware.SetTokenParams(false)
+
+	if w := request("", "test-token-123"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected body token to be rejected with token params off, got %d", w.Code)
+	}
+	
+	if w := request("bearer test-token-123", ""); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for a bearer token, got %d", w.Code)
+	}
+}
+
+func TestAuthMiddleware_ValidateAndLogout(t *testing.T) {
+	tokenStore := userdb.NewTokenStore()
+	authService := auth.NewService("test-secret", tokenStore)
+	middleware := NewAuthMiddleware(authService)
+	middleware.SetTokenParams(false)
+	handler := NewUserHandler(authService)
+
+
+	tokenStore.AddToken("test-token-123", 1)
+
+
+	req := httptest.NewRequest("GET", "/validate?token=test-token-123", nil)
+	w := httptest.NewRecorder()
+	middleware.Authenticate(http.HandlerFunc(handler.ValidateToken)).ServeHTTP(w, req)
+	
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 for a query token with token params off, got %d", w.Code)
+	}
+	
+	req = httptest.NewRequest("GET", "/validate", nil)
+	req.Header.Set("Authorization", "Bearer test-token-123")
+	w = httptest.NewRecorder()
+	middleware.Authenticate(http.HandlerFunc(handler.ValidateToken)).ServeHTTP(w, req)
+	
+	var response auth.ValidateResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || !response.Valid {
+		t.Fatalf("Expected bearer token to be valid, got %s", w.Body.String())
+	}
+	
+	req = httptest.NewRequest("POST", "/logout", nil)
+	req.Header.Set("Authorization", "Bearer test-token-123")
+	w = httptest.NewRecorder()
+	middleware.Authenticate(http.HandlerFunc(handler.Logout)).ServeHTTP(w, req)
+	
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d", w.Code)
+	}
+	
+	if result, _ := authService.ValidateToken("test-token-123"); result.Valid {
+		t.Fatal("Expected token to be revoked after logout")
+	}
+}
+
+func TestAuthHandler_RefreshToken(t *testing.T) {
+	tokenStore := userdb.NewTokenStore()
+	authService := auth.NewService("test-secret", tokenStore)
+	authService.SetUserStore(newTestUsers(t))
+	handler := NewAuthHandler(authService)
+
+
+	login, err := authService.GenerateToken(&auth.AuthRequest{Email: "test@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+
+
+	refresh := func(refreshToken string) *httptest.ResponseRecorder {
+		bodyBytes, _ := json.Marshal(auth.RefreshRequest{RefreshToken: refreshToken})
+		req := httptest.NewRequest("POST", "/auth/refresh", bytes.NewBuffer(bodyBytes))
+		w := httptest.NewRecorder()
+		handler.RefreshToken(w, req)
+		return w
+	}
+	
+	w := refresh(login.RefreshToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	
+	var response auth.AuthResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	
+	if response.Token == "" || response.RefreshToken == "" || response.RefreshToken == login.RefreshToken {
+		t.Fatalf("Expected a rotated token pair, got %+v", response)
+	}
+	
+	if w := refresh(login.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401 for a reused refresh token, got %d", w.Code)
+	}
+	
+	if w := refresh(""); w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d", w.Code)
+	}
+}
+
+func TestAPIKeyHandler_Lifecycle(t *testing.T) {
+	tokenStore := userdb.NewTokenStore()
+	authService := auth.NewService("test-secret", tokenStore)
+	authService.SetAdmins([]int{9})
+	analyticsService := analytics.NewService(&analytics.MemoryDataSource{})
+	analyticsHandler := NewAnalyticsHandler(analyticsService, authService)
+	handler := NewAPIKeyHandler(authService)
+	middleware := NewAuthMiddleware(authService)
+
+	router := mux.NewRouter()
+	readRoutes := router.NewRoute().Subrouter()
+	readRoutes.Use(middleware.Require(auth.PermReadAnalytics))
+	readRoutes.HandleFunc("/analytics", analyticsHandler.GetItemAnalytics).Methods("POST")
+	exploreRoutes := router.NewRoute().Subrouter()
+	exploreRoutes.Use(middleware.Require(auth.PermExploreAnalytics))
+	exploreRoutes.HandleFunc("/analytics/groups", analyticsHandler.GetGroupAnalytics).Methods("POST")
+	adminRoutes := router.PathPrefix("/admin").Subrouter()
+	adminRoutes.Use(middleware.Require(auth.PermAdmin))
+	adminRoutes.HandleFunc("/api-keys", handler.CreateAPIKey).Methods("POST")
+	adminRoutes.HandleFunc("/api-keys", handler.ListAPIKeys).Methods("GET")
+	adminRoutes.HandleFunc("/api-keys/{id}", handler.RevokeAPIKey).Methods("DELETE")
+
+
+	tokenStore.SaveToken(userdb.TokenRecord{Token: "admin-token", UserID: 9, Tenant: userdb.DefaultTenant})
+
+
+	send := func(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+		bodyBytes, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	
+	w := send("POST", "/admin/api-keys", "admin-token", auth.CreateAPIKeyRequest{Name: "etl", Scopes: []auth.Permission{auth.PermReadAnalytics}})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	
+	var created auth.CreateAPIKeyResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	
+	if w := send("POST", "/admin/api-keys", "admin-token", auth.CreateAPIKeyRequest{Name: "etl"}); w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 without scopes, got %d", w.Code)
+	}
+	
+	query := analytics.ItemAnalyticsRequest{StartDate: "01.01.2024", FinishDate: "31.01.2024"}
+	if w := send("POST", "/analytics", created.Key, query); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 with the API key, got %d", w.Code)
+	}
+	
+	if w := send("POST", "/analytics/groups", created.Key, query); w.Code != http.StatusForbidden {
+		t.Fatalf("Expected status 403 outside the key's scopes, got %d", w.Code)
+	}
+	
+	if w := send("GET", "/admin/api-keys", created.Key, nil); w.Code != http.StatusForbidden {
+		t.Fatalf("Expected status 403 for a read-only key on admin routes, got %d", w.Code)
+	}
+	
+	w = send("GET", "/admin/api-keys", "admin-token", nil)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), created.Key) || strings.Contains(w.Body.String(), "hash") {
+		t.Fatalf("Expected a listing without secrets, got %d: %s", w.Code, w.Body.String())
+	}
+	
+	var listed []auth.APIKeyInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &listed); err != nil || len(listed) != 1 || listed[0].LastUsedAt == nil {
+		t.Fatalf("Expected one used key, got %+v, %v", listed, err)
+	}
+	
+	if w := send("DELETE", "/admin/api-keys/"+created.ID, "admin-token", nil); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d", w.Code)
+	}
+	
+	if w := send("DELETE", "/admin/api-keys/missing", "admin-token", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404, got %d", w.Code)
+	}
+	
+	if w := send("POST", "/analytics", created.Key, query); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401 for a revoked key, got %d", w.Code)
+	}
+}
+
+func TestAuditHandler_TrackAndQuery(t *testing.T) {
+	tokenStore := userdb.NewTokenStore()
+	authService := auth.NewService("test-secret", tokenStore)
+	analyticsHandler := NewAnalyticsHandler(analytics.NewService(&analytics.MemoryDataSource{}), authService)
+
+	auditLog := audit.NewLog()
+	auditHandler := NewAuditHandler(auditLog)
+	middleware := NewAuthMiddleware(authService)
+	middleware.SetAuditLog(auditLog)
+
+	router := mux.NewRouter()
+	router.Use(middleware.Require(auth.PermReadAnalytics), auditHandler.Track)
+	router.HandleFunc("/analytics", analyticsHandler.GetItemAnalytics).Methods("POST")
+
+
+	tokenStore.AddToken("test-token-123", 1)
+
+
+	request := func(token, start, finish string) int {
+		bodyBytes, _ := json.Marshal(analytics.ItemAnalyticsRequest{StartDate: start, FinishDate: finish, Limit: 10})
+		req := httptest.NewRequest("POST", "/analytics", bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	
+	status := request("test-token-123", "01.01.2024", "31.01.2024")
+	request("test-token-123", "01.02.2024", "29.02.2024")
+	request("invalid-token", "01.01.2024", "31.01.2024")
+	
+
+	query := func(params string) []audit.Event {
+		req := httptest.NewRequest("GET", "/admin/audit?"+params, nil)
+		w := httptest.NewRecorder()
+		auditHandler.Query(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var events []audit.Event
+		if err := json.Unmarshal(w.Body.Bytes(), &events); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		return events
+	}
+	
+	events := query("type=analytics&tenant=default&covers=15.01.2024")
+	if len(events) != 1 {
+		t.Fatalf("Expected one January request, got %+v", events)
+	}
+	
+	event := events[0]
+	if event.UserID != 1 || event.Path != "/analytics" || event.Status != status || event.FinishDate != "31.01.2024" {
+		t.Fatalf("Unexpected audit event: %+v", event)
+	}
+	
+	if !strings.Contains(string(event.Filters), `"Limit":10`) {
+		t.Fatalf("Expected the filters to be recorded, got %s", event.Filters)
+	}
+	
+
+	if rejected := query("type=token.rejected"); len(rejected) != 1 || rejected[0].Status != http.StatusUnauthorized {
+		t.Fatalf("Expected the invalid token to be recorded, got %+v", rejected)
+	}
+	
+	req := httptest.NewRequest("GET", "/admin/audit?covers=2024-01-15", nil)
+	w := httptest.NewRecorder()
+	auditHandler.Query(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 for a malformed date, got %d", w.Code)
+	}
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"analytics-service/internal/audit"
+	"analytics-service/internal/auth"
+
+	"github.com/gorilla/mux"
+)
+
+// maxTokenPeek bounds how much of a request body is read to find the token.
+// Bodies larger than that are uploads, which pass the token in the query.
+const maxTokenPeek = 1 << 20
+
+// AuthMiddleware reads the caller's token, preferably from the
+// "Authorization: Bearer" header, and hands the token and the resolved
+// principal to the handler via the request context.
+type AuthMiddleware struct {
+	authService *auth.Service
+	auditLog    *audit.Log
+	tokenParams bool
+	warnOnce    sync.Once
+}
+
+func NewAuthMiddleware(authService *auth.Service) *AuthMiddleware {
+	return &AuthMiddleware{
+		authService: authService,
+		auditLog:    audit.NewLog(),
+		tokenParams: true,
+	}
+}
+
+// SetAuditLog sets where rejected tokens and denied requests are recorded.
+func (m *AuthMiddleware) SetAuditLog(auditLog *audit.Log) {
+	if auditLog != nil {
+		m.auditLog = auditLog
+	}
+}
+
+// SetTokenParams controls whether tokens passed in the ?token= query
+// parameter or the "token" body field are still accepted. Both are
+// deprecated: they end up in access logs and proxy caches.
+func (m *AuthMiddleware) SetTokenParams(allow bool) {
+	m.tokenParams = allow
+}
+
+// Authenticate attaches the caller's token and, when it is valid, principal
+// to the request but leaves it to the handler to refuse anonymous callers.
+func (m *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := m.requestToken(w, r)
+		ctx := context.WithValue(r.Context(), tokenKey{}, token)
+		if principal, ok := m.authenticate(r, token); ok {
+			ctx = auth.WithPrincipal(ctx, principal)
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Require refuses callers without a valid token or whose role lacks perm.
+func (m *AuthMiddleware) Require(perm auth.Permission) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := m.requestToken(w, r)
+			principal, ok := m.authenticate(r, token)
+			if !ok {
+				event := auditEvent(r, audit.TokenRejected, nil)
+				event.Status = http.StatusUnauthorized
+				if token == "" {
+					event.Detail = "no token"
+				}
+				m.auditLog.Record(event)
+				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				return
+			}
+
+			if !principal.Can(perm) {
+				log.Printf("%s denied %s on %s", principal, perm, r.URL.Path)
+				event := auditEvent(r, audit.AccessDenied, principal)
+				event.Status = http.StatusForbidden
+				event.Detail = string(perm)
+				m.auditLog.Record(event)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), tokenKey{}, token)
+			next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(ctx, principal)))
+		})
+	}
+}
+
+// authenticate resolves user tokens and API keys alike. API keys are also
+// checked against their IP allowlist.
+func (m *AuthMiddleware) authenticate(r *http.Request, token string) (*auth.Principal, bool) {
+	if strings.HasPrefix(token, auth.APIKeyPrefix) {
+		return m.authService.AuthenticateAPIKey(token, remoteIP(r))
+	}
+	return m.authService.Authenticate(token)
+}
+
+// remoteIP is the address of the direct peer. Forwarding headers are ignored
+// since they are trivial to forge without a trusted proxy in front.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (m *AuthMiddleware) requestToken(w http.ResponseWriter, r *http.Request) string {
+	if token, ok := bearerToken(r); ok {
+		return token
+	}
+
+	if !m.tokenParams {
+		return ""
+	}
+
+	token := paramToken(r)
+	if token != "" {
+		w.Header().Set("Deprecation", "true")
+		m.warnOnce.Do(func() {
+			log.Printf("Warning: clients still pass tokens in the query or body (first seen on %s); switch them to the Authorization header", r.URL.Path)
+		})
+	}
+	return token
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// paramToken takes the token from the query string or, failing that, from
+// the "token" field of a JSON body. The body is put back so the handler can
+// decode it again.
+func paramToken(r *http.Request) string {
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token
+	}
+
+	if r.Body == nil {
+		return ""
+	}
+
+	peeked, err := io.ReadAll(io.LimitReader(r.Body, maxTokenPeek))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(peeked), r.Body), r.Body}
+	if err != nil {
+		return ""
+	}
+
+	var body struct {
+		Token string `json:"token"`
+	}
+	if json.Unmarshal(peeked, &body) != nil {
+		return ""
+	}
+	return body.Token
+}
+
+type tokenKey struct{}
+
+// contextToken returns the token the auth middleware found, which is empty
+// when the request carried none. ok is false for handlers mounted without
+// the middleware.
+func contextToken(r *http.Request) (token string, ok bool) {
+	token, ok = r.Context().Value(tokenKey{}).(string)
+	return token, ok
+}
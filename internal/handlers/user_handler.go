@@ -2,23 +2,39 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 
+	"analytics-service/internal/audit"
 	"analytics-service/internal/auth"
 )
 
 type UserHandler struct {
 	authService *auth.Service
+	auditLog    *audit.Log
 }
 
 func NewUserHandler(authService *auth.Service) *UserHandler {
 	return &UserHandler{
 		authService: authService,
+		auditLog:    audit.NewLog(),
+	}
+}
+
+// SetAuditLog sets where failed validations and revocations are recorded.
+func (h *UserHandler) SetAuditLog(auditLog *audit.Log) {
+	if auditLog != nil {
+		h.auditLog = auditLog
 	}
 }
 
 func (h *UserHandler) ValidateToken(w http.ResponseWriter, r *http.Request) {
-	token := r.URL.Query().Get("token")
+	token, ok := contextToken(r)
+	if !ok {
+		token = r.URL.Query().Get("token")
+	}
 	if token == "" {
 		http.Error(w, "Token parameter is required", http.StatusBadRequest)
 		return
@@ -29,8 +45,91 @@ func (h *UserHandler) ValidateToken(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to validate token", http.StatusInternalServerError)
 		return
 	}
+	if !response.Valid {
+		event := auditEvent(r, audit.TokenRejected, nil)
+		event.Status = http.StatusOK
+		event.Detail = "validate"
+		h.auditLog.Record(event)
+	}
 
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
+
+func (h *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	token, ok := contextToken(r)
+	if !ok {
+		var req auth.LogoutRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		token = req.Token
+	}
+
+	if token == "" {
+		http.Error(w, "Token is required", http.StatusBadRequest)
+		return
+	}
+
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	err := h.authService.Logout(token)
+	if errors.Is(err, auth.ErrInvalidToken) {
+		event := auditEvent(r, audit.TokenRejected, nil)
+		event.Status = http.StatusUnauthorized
+		event.Detail = "logout"
+		h.auditLog.Record(event)
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Printf("Logout error: %v", err)
+		http.Error(w, "Failed to revoke token", http.StatusInternalServerError)
+		return
+	}
+
+	event := auditEvent(r, audit.TokenRevoked, principal)
+	event.Status = http.StatusNoContent
+	event.Detail = "logout"
+	h.auditLog.Record(event)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *UserHandler) RevokeUserTokens(w http.ResponseWriter, r *http.Request) {
+	var req auth.RevokeUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.UserID == 0 {
+		http.Error(w, "user_id is required", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := auth.PrincipalFromContext(r.Context()); !ok && !h.authService.IsAdmin(req.Token) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	revoked, err := h.authService.RevokeUserTokens(req.UserID)
+	if err != nil {
+		log.Printf("Revocation error for user %d: %v", req.UserID, err)
+		http.Error(w, "Failed to revoke tokens", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Revoked %d tokens of user %d", revoked, req.UserID)
+
+	admin, _ := auth.PrincipalFromContext(r.Context())
+	event := auditEvent(r, audit.TokenRevoked, admin)
+	event.Status = http.StatusOK
+	event.Detail = fmt.Sprintf("%d tokens of user %d", revoked, req.UserID)
+	h.auditLog.Record(event)
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(auth.RevokeUserResponse{Revoked: revoked})
+}
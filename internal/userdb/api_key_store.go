@@ -0,0 +1,216 @@
+package userdb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// lastUsedResolution is how stale the persisted LastUsedAt may get. Writing
+// the file on every request of a busy ETL job would be wasteful.
+const lastUsedResolution = time.Minute
+
+var (
+	ErrAPIKeyExists   = errors.New("api key already exists")
+	ErrAPIKeyNotFound = errors.New("api key not found")
+)
+
+// APIKey is a long-lived credential for machine clients. Only the SHA-256 of
+// the key is kept; Scopes name auth permissions and AllowedIPs holds
+// addresses or CIDR ranges, empty meaning any.
+type APIKey struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Hash       string    `json:"hash"`
+	Tenant     string    `json:"tenant,omitempty"`
+	Scopes     []string  `json:"scopes"`
+	AllowedIPs []string  `json:"allowed_ips,omitempty"`
+	CreatedBy  int       `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at,omitempty"`
+	LastUsedAt time.Time `json:"last_used_at,omitempty"`
+	Revoked    bool      `json:"revoked,omitempty"`
+}
+
+// Expired reports whether the key has an expiry that has passed.
+func (k *APIKey) Expired(now time.Time) bool {
+	return !k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt)
+}
+
+// APIKeyStore keeps API keys keyed by ID. Stores opened from a file write
+// every change back; last-used times are tracked in memory and written out
+// at most once per lastUsedResolution.
+type APIKeyStore struct {
+	keys     map[string]*APIKey
+	lastUsed map[string]time.Time
+	path     string
+	mu       sync.RWMutex
+}
+
+func NewAPIKeyStore() *APIKeyStore {
+	return &APIKeyStore{
+		keys:     make(map[string]*APIKey),
+		lastUsed: make(map[string]time.Time),
+	}
+}
+
+// OpenAPIKeyStore loads keys from path if it exists and persists later
+// changes there.
+func OpenAPIKeyStore(path string) (*APIKeyStore, error) {
+	ks := NewAPIKeyStore()
+	ks.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ks, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open api key file: %w", err)
+	}
+
+	var keys []APIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse api key file: %w", err)
+	}
+
+	for i := range keys {
+		key := keys[i]
+		if key.ID == "" || key.Hash == "" {
+			return nil, fmt.Errorf("api key %d: id and hash are required", i)
+		}
+		ks.keys[key.ID] = &key
+	}
+	return ks, nil
+}
+
+func (ks *APIKeyStore) Create(key APIKey) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if _, exists := ks.keys[key.ID]; exists {
+		return ErrAPIKeyExists
+	}
+
+	ks.keys[key.ID] = &key
+	if err := ks.save(); err != nil {
+		delete(ks.keys, key.ID)
+		return err
+	}
+	return nil
+}
+
+// List returns every key, revoked and expired ones included, oldest first.
+func (ks *APIKeyStore) List() []APIKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.sorted()
+}
+
+// Lookup finds a key by the hash of its secret.
+func (ks *APIKeyStore) Lookup(hash string) (APIKey, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	for _, key := range ks.keys {
+		if key.Hash == hash {
+			return *key, true
+		}
+	}
+	return APIKey{}, false
+}
+
+func (ks *APIKeyStore) Revoke(id string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	current, exists := ks.keys[id]
+	if !exists {
+		return ErrAPIKeyNotFound
+	}
+
+	updated := *current
+	updated.Revoked = true
+
+	ks.keys[id] = &updated
+	if err := ks.save(); err != nil {
+		ks.keys[id] = current
+		return err
+	}
+	return nil
+}
+
+// Touch records that the key was used at. The file is only rewritten when
+// the stored time is older than lastUsedResolution.
+func (ks *APIKeyStore) Touch(id string, at time.Time) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	key, exists := ks.keys[id]
+	if !exists {
+		return ErrAPIKeyNotFound
+	}
+
+	ks.lastUsed[id] = at
+	if at.Sub(key.LastUsedAt) < lastUsedResolution {
+		return nil
+	}
+
+	key.LastUsedAt = at
+	return ks.save()
+}
+
+// sorted returns copies of the keys with their latest last-used time.
+func (ks *APIKeyStore) sorted() []APIKey {
+	keys := make([]APIKey, 0, len(ks.keys))
+	for id, key := range ks.keys {
+		copied := *key
+		if at, ok := ks.lastUsed[id]; ok {
+			copied.LastUsedAt = at
+		}
+		keys = append(keys, copied)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	return keys
+}
+
+// save writes all keys to the backing file via a temp file and rename. The
+// caller must hold the write lock.
+func (ks *APIKeyStore) save() error {
+	if ks.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(ks.sorted(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode api keys: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(ks.path), ".api-keys-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to save api keys: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save api keys: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save api keys: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), ks.path); err != nil {
+		return fmt.Errorf("failed to save api keys: %w", err)
+	}
+	return nil
+}
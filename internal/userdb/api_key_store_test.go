@@ -0,0 +1,61 @@
+package userdb
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAPIKeyStore_PersistsKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api_keys.json")
+
+	store, err := OpenAPIKeyStore(path)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	created := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	if err := store.Create(APIKey{ID: "k1", Name: "etl", Hash: "h1", Scopes: []string{"analytics:read"}, CreatedAt: created}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	store.Create(APIKey{ID: "k2", Name: "bi", Hash: "h2", Scopes: []string{"analytics:read"}, CreatedAt: created.Add(time.Hour)})
+
+	if err := store.Create(APIKey{ID: "k1", Hash: "h3"}); !errors.Is(err, ErrAPIKeyExists) {
+		t.Fatalf("Expected ErrAPIKeyExists, got %v", err)
+	}
+
+	if err := store.Revoke("k2"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if err := store.Revoke("missing"); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Fatalf("Expected ErrAPIKeyNotFound, got %v", err)
+	}
+
+	store.Touch("k1", created.Add(2*time.Hour))
+	store.Touch("k1", created.Add(2*time.Hour+time.Second))
+
+
+	reopened, err := OpenAPIKeyStore(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+
+	keys := reopened.List()
+	if len(keys) != 2 || keys[0].ID != "k1" || !keys[1].Revoked {
+		t.Fatalf("Expected k1 and revoked k2, got %+v", keys)
+	}
+
+	if !keys[0].LastUsedAt.Equal(created.Add(2 * time.Hour)) {
+		t.Fatalf("Expected only the first use within a minute to be written, got %v", keys[0].LastUsedAt)
+	}
+
+	if latest := store.List()[0].LastUsedAt; !latest.Equal(created.Add(2*time.Hour + time.Second)) {
+		t.Fatalf("Expected the latest use in memory, got %v", latest)
+	}
+
+	if key, exists := reopened.Lookup("h1"); !exists || key.Name != "etl" {
+		t.Fatalf("Expected to find k1 by hash, got %+v", key)
+	}
+}
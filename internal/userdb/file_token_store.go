@@ -0,0 +1,366 @@
+package userdb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FileTokenStore persists the allow list as a JSON-lines journal. Every change
+// appends the full record; on open the journal is replayed, later lines win,
+// and it is compacted down to the records that can still matter.
+type FileTokenStore struct {
+	tokens *MemoryTokenStore
+	path   string
+	file   *os.File
+	mu     sync.Mutex
+}
+
+// OpenFileTokenStore opens or creates the journal at path. When the journal
+// does not exist yet, tokens from the legacy LogPas.txt file are imported
+// once so that existing clients keep working.
+func OpenFileTokenStore(path, legacyPath string) (*FileTokenStore, error) {
+	ts := &FileTokenStore{
+		tokens: NewTokenStore(),
+		path:   path,
+	}
+
+	_, err := os.Stat(path)
+	switch {
+	case err == nil:
+		if err := ts.replay(); err != nil {
+			return nil, err
+		}
+	case errors.Is(err, os.ErrNotExist):
+		if legacyPath != "" {
+			if err := ts.migrate(legacyPath); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("failed to open token store: %w", err)
+	}
+
+	if err := ts.compact(); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open token store: %w", err)
+	}
+	ts.file = file
+
+	return ts, nil
+}
+
+func (ts *FileTokenStore) replay() error {
+	file, err := os.Open(ts.path)
+	if err != nil {
+		return fmt.Errorf("failed to open token store: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var record TokenRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// A torn final write is expected after a crash; anything else
+			// is still skipped so one bad line cannot lock everyone out.
+			log.Printf("Warning: skipping malformed token record at %s:%d: %v", ts.path, line, err)
+			continue
+		}
+		if record.Removed {
+			ts.tokens.RemoveToken(record.Token)
+			continue
+		}
+		ts.tokens.SaveToken(record)
+	}
+
+	return scanner.Err()
+}
+
+func (ts *FileTokenStore) migrate(legacyPath string) error {
+	records, err := readLegacyTokens(legacyPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		ts.tokens.SaveToken(record)
+	}
+	log.Printf("Migrated %d tokens from %s to %s", len(records), legacyPath, ts.path)
+	return nil
+}
+
+// compact rewrites the journal without expired records.
+func (ts *FileTokenStore) compact() error {
+	now := time.Now()
+	records := ts.tokens.snapshot()
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].CreatedAt.Equal(records[j].CreatedAt) {
+			return records[i].CreatedAt.Before(records[j].CreatedAt)
+		}
+		return records[i].Token < records[j].Token
+	})
+
+	tmp, err := os.CreateTemp(filepath.Dir(ts.path), ".tokens-*.jsonl")
+	if err != nil {
+		return fmt.Errorf("failed to compact token store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(w)
+	for _, record := range records {
+		if record.expired(now) {
+			ts.tokens.RemoveToken(record.Token)
+			continue
+		}
+		if err := encoder.Encode(record); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to compact token store: %w", err)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to compact token store: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to compact token store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to compact token store: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), ts.path); err != nil {
+		return fmt.Errorf("failed to compact token store: %w", err)
+	}
+	return nil
+}
+
+// append writes record to the journal and syncs it before the in-memory view
+// is updated, so a change is never visible unless it survives a restart.
+func (ts *FileTokenStore) append(record TokenRecord) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	return ts.appendLocked(record)
+}
+
+func (ts *FileTokenStore) appendLocked(record TokenRecord) error {
+	if err := ts.writeLocked([]TokenRecord{record}); err != nil {
+		return err
+	}
+	return ts.tokens.SaveToken(record)
+}
+
+// writeLocked appends records to the journal with a single sync. The caller
+// must hold the lock and update the in-memory view afterwards.
+func (ts *FileTokenStore) writeLocked(records []TokenRecord) error {
+	var buf bytes.Buffer
+	for _, record := range records {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to encode token record: %w", err)
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	if ts.file == nil {
+		return errors.New("token store is closed")
+	}
+	if _, err := ts.file.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write token record: %w", err)
+	}
+	if err := ts.file.Sync(); err != nil {
+		return fmt.Errorf("failed to write token record: %w", err)
+	}
+	return nil
+}
+
+// ReloadLegacy makes the legacy tokens in the store match the file at path,
+// the way MemoryTokenStore.LoadFromFile does, and journals the changes. All
+// changes become visible to lookups at once. A missing file changes nothing,
+// so deleting LogPas.txt after the first migration is safe.
+func (ts *FileTokenStore) ReloadLegacy(path string) (LegacyChanges, error) {
+	records, err := readLegacyTokens(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return LegacyChanges{}, nil
+	}
+	if err != nil {
+		return LegacyChanges{}, err
+	}
+
+	// ts.mu is held by every writer, so the view cannot change between
+	// computing the changes and applying them.
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	ts.tokens.mu.RLock()
+	changes := legacyChanges(ts.tokens.tokens, records)
+	ts.tokens.mu.RUnlock()
+	if changes.Empty() {
+		return changes, nil
+	}
+
+	if err := ts.writeLocked(changes.records()); err != nil {
+		return LegacyChanges{}, err
+	}
+
+	ts.tokens.mu.Lock()
+	ts.tokens.applyLocked(changes.records())
+	ts.tokens.mu.Unlock()
+	return changes, nil
+}
+
+// WatchLegacy reloads the legacy file whenever its modification time or size
+// changes, checking every interval until ctx is done. Files that fail to
+// parse are reported and left unapplied until they are fixed.
+func (ts *FileTokenStore) WatchLegacy(ctx context.Context, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := legacyFileVersion(path)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			version := legacyFileVersion(path)
+			if version == last {
+				continue
+			}
+			last = version
+
+			changes, err := ts.ReloadLegacy(path)
+			if err != nil {
+				log.Printf("Warning: not reloading %s: %v", path, err)
+				continue
+			}
+			if !changes.Empty() {
+				log.Printf("Reloaded %s: %s", path, changes.String())
+			}
+		}
+	}
+}
+
+func legacyFileVersion(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d-%d", info.ModTime().UnixNano(), info.Size())
+}
+
+func (ts *FileTokenStore) SaveToken(record TokenRecord) error {
+	return ts.append(record)
+}
+
+func (ts *FileTokenStore) RevokeToken(token string) error {
+	record, exists := ts.tokens.find(token)
+	if !exists || record.Revoked {
+		return nil
+	}
+
+	record.Revoked = true
+	return ts.append(record)
+}
+
+func (ts *FileTokenStore) RevokeUserTokens(userID int) (int, error) {
+	return ts.revokeWhere(func(record TokenRecord) bool { return record.UserID == userID })
+}
+
+func (ts *FileTokenStore) RevokeFamily(family string) (int, error) {
+	if family == "" {
+		return 0, nil
+	}
+	return ts.revokeWhere(func(record TokenRecord) bool { return record.Family == family })
+}
+
+func (ts *FileTokenStore) revokeWhere(match func(TokenRecord) bool) (int, error) {
+	revoked := 0
+	for _, record := range ts.tokens.snapshot() {
+		if !match(record) || record.Revoked {
+			continue
+		}
+
+		record.Revoked = true
+		if err := ts.append(record); err != nil {
+			return revoked, err
+		}
+		revoked++
+	}
+	return revoked, nil
+}
+
+// ConsumeToken holds the journal lock between the check and the write so
+// that a token can only be consumed once.
+func (ts *FileTokenStore) ConsumeToken(token string) (TokenRecord, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	record, exists := ts.tokens.find(token)
+	if !exists {
+		return TokenRecord{}, ErrTokenNotFound
+	}
+	if record.Revoked {
+		return record, ErrTokenReused
+	}
+
+	consumed := record
+	consumed.Revoked = true
+	if err := ts.appendLocked(consumed); err != nil {
+		return TokenRecord{}, err
+	}
+	return record, nil
+}
+
+func (ts *FileTokenStore) ValidateToken(token string) (int, bool) {
+	return ts.tokens.ValidateToken(token)
+}
+
+func (ts *FileTokenStore) LookupToken(token string) (TokenRecord, bool) {
+	return ts.tokens.LookupToken(token)
+}
+
+func (ts *FileTokenStore) GetTokenCount() int {
+	return ts.tokens.GetTokenCount()
+}
+
+func (ts *FileTokenStore) MaxUserID() int {
+	return ts.tokens.MaxUserID()
+}
+
+func (ts *FileTokenStore) Close() error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.file == nil {
+		return nil
+	}
+	err := ts.file.Close()
+	ts.file = nil
+	return err
+}
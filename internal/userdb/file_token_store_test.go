@@ -0,0 +1,268 @@
+package userdb
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileTokenStore_MigratesLegacyFileOnce(t *testing.T) {
+	dir := t.TempDir()
+	legacyPath := filepath.Join(dir, "LogPas.txt")
+	dbPath := filepath.Join(dir, "tokens.jsonl")
+
+	if err := os.WriteFile(legacyPath, []byte("token1 1\ntoken2 2\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write legacy file: %v", err)
+	}
+
+
+	store, err := OpenFileTokenStore(dbPath, legacyPath)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	if userID, exists := store.ValidateToken("token2"); !exists || userID != 2 {
+		t.Fatalf("Expected migrated token2 for user 2, got %d, %v", userID, exists)
+	}
+
+	if err := store.RevokeToken("token1"); err != nil {
+		t.Fatalf("Failed to revoke: %v", err)
+	}
+	store.Close()
+
+
+	// A second start must not resurrect the revoked legacy token.
+	store, err = OpenFileTokenStore(dbPath, legacyPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer store.Close()
+
+	if _, exists := store.ValidateToken("token1"); exists {
+		t.Fatal("Expected revoked token to stay revoked after restart")
+	}
+
+	if count := store.GetTokenCount(); count != 1 {
+		t.Fatalf("Expected 1 active token, got %d", count)
+	}
+}
+
+func TestFileTokenStore_PersistsAndCompacts(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "tokens.jsonl")
+
+	store, err := OpenFileTokenStore(dbPath, "")
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	now := time.Now()
+	records := []TokenRecord{
+		{Token: "live", UserID: 1, CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+		{Token: "stale", UserID: 1, CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)},
+	}
+	for _, record := range records {
+		if err := store.SaveToken(record); err != nil {
+			t.Fatalf("Failed to save %s: %v", record.Token, err)
+		}
+	}
+	store.Close()
+
+
+	// Simulate a write torn by a crash.
+	f, _ := os.OpenFile(dbPath, os.O_WRONLY|os.O_APPEND, 0o600)
+	f.WriteString(`{"token": "torn`)
+	f.Close()
+
+
+	store, err = OpenFileTokenStore(dbPath, "")
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer store.Close()
+
+	if userID, exists := store.ValidateToken("live"); !exists || userID != 1 {
+		t.Fatalf("Expected live token to survive restart, got %d, %v", userID, exists)
+	}
+
+	data, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to read journal: %v", err)
+	}
+
+	if strings.Contains(string(data), "stale") || strings.Contains(string(data), "torn") {
+		t.Fatalf("Expected compaction to drop expired and malformed records, got %s", data)
+	}
+}
+
+func TestFileTokenStore_RevokeUserTokens(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "tokens.jsonl")
+
+	store, err := OpenFileTokenStore(dbPath, "")
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	now := time.Now()
+	for _, record := range []TokenRecord{
+		{Token: "a", UserID: 1, CreatedAt: now},
+		{Token: "b", UserID: 1, CreatedAt: now},
+		{Token: "c", UserID: 2, CreatedAt: now},
+	} {
+		store.SaveToken(record)
+	}
+
+	revoked, err := store.RevokeUserTokens(1)
+	if err != nil || revoked != 2 {
+		t.Fatalf("Expected 2 revoked tokens, got %d, %v", revoked, err)
+	}
+	store.Close()
+
+
+	store, err = OpenFileTokenStore(dbPath, "")
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer store.Close()
+
+	if _, exists := store.ValidateToken("a"); exists {
+		t.Fatal("Expected revocation to be persisted")
+	}
+
+	if _, exists := store.ValidateToken("c"); !exists {
+		t.Fatal("Expected other users' tokens to survive")
+	}
+}
+
+func TestFileTokenStore_ConsumeAndRevokeFamily(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "tokens.jsonl")
+
+	store, err := OpenFileTokenStore(dbPath, "")
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	now := time.Now()
+	store.SaveToken(TokenRecord{Token: "access-1", UserID: 1, Family: "f1", CreatedAt: now})
+	store.SaveToken(TokenRecord{Token: "refresh-1", UserID: 1, Kind: KindRefresh, Family: "f1", CreatedAt: now})
+	store.SaveToken(TokenRecord{Token: "refresh-2", UserID: 1, Kind: KindRefresh, Family: "f2", CreatedAt: now})
+
+	if record, err := store.ConsumeToken("refresh-1"); err != nil || record.Family != "f1" {
+		t.Fatalf("Expected to consume refresh-1, got %+v, %v", record, err)
+	}
+	store.Close()
+
+
+	// Consumption must survive a restart, or a stolen token could be replayed.
+	store, err = OpenFileTokenStore(dbPath, "")
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer store.Close()
+
+	if record, err := store.ConsumeToken("refresh-1"); !errors.Is(err, ErrTokenReused) || record.Family != "f1" {
+		t.Fatalf("Expected ErrTokenReused with the record, got %+v, %v", record, err)
+	}
+
+	if _, err := store.ConsumeToken("missing"); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("Expected ErrTokenNotFound, got %v", err)
+	}
+
+	revoked, err := store.RevokeFamily("f1")
+	if err != nil || revoked != 1 {
+		t.Fatalf("Expected 1 revoked token, got %d, %v", revoked, err)
+	}
+
+	if _, exists := store.LookupToken("access-1"); exists {
+		t.Fatal("Expected access token of the family to be revoked")
+	}
+
+	if _, exists := store.LookupToken("refresh-2"); !exists {
+		t.Fatal("Expected other families to survive")
+	}
+
+	if revoked, _ := store.RevokeFamily(""); revoked != 0 {
+		t.Fatalf("Expected an empty family to match nothing, got %d", revoked)
+	}
+}
+
+func TestFileTokenStore_ReloadLegacy(t *testing.T) {
+	dir := t.TempDir()
+	legacyPath := filepath.Join(dir, "LogPas.txt")
+	dbPath := filepath.Join(dir, "tokens.jsonl")
+
+	writeLegacy := func(content string) {
+		if err := os.WriteFile(legacyPath, []byte(content), 0o600); err != nil {
+			t.Fatalf("Failed to write legacy file: %v", err)
+		}
+	}
+	writeLegacy("token1 1\ntoken2 2\ntoken3 3\n")
+
+
+	store, err := OpenFileTokenStore(dbPath, legacyPath)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	store.SaveToken(TokenRecord{Token: "jti-1", UserID: 2, CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)})
+	store.RevokeToken("token2")
+
+	writeLegacy("# rotated\ntoken2 2\ntoken3 3 client-b\ntoken4 4\n")
+	changes, err := store.ReloadLegacy(legacyPath)
+	if err != nil {
+		t.Fatalf("Failed to reload: %v", err)
+	}
+	if len(changes.Added) != 1 || len(changes.Updated) != 1 || len(changes.Removed) != 1 {
+		t.Fatalf("Expected 1 added, 1 updated and 1 removed, got %s", changes.String())
+	}
+
+
+	check := func(store *FileTokenStore) {
+		t.Helper()
+		if _, exists := store.ValidateToken("token1"); exists {
+			t.Fatal("Expected token removed from the file to be rejected")
+		}
+		if _, exists := store.ValidateToken("token2"); exists {
+			t.Fatal("Expected revoked token to stay revoked")
+		}
+		if record, exists := store.LookupToken("token3"); !exists || record.Tenant != "client-b" {
+			t.Fatalf("Expected token3 to move to client-b, got %+v", record)
+		}
+		if _, exists := store.ValidateToken("token4"); !exists {
+			t.Fatal("Expected token added to the file to be accepted")
+		}
+		if _, exists := store.ValidateToken("jti-1"); !exists {
+			t.Fatal("Expected issued tokens to be left alone")
+		}
+	}
+	check(store)
+	store.Close()
+
+
+	store, err = OpenFileTokenStore(dbPath, legacyPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer store.Close()
+	check(store)
+
+
+	writeLegacy("token2 2\nbroken\ntoken3 x\ntoken2 2\n")
+	_, err = store.ReloadLegacy(legacyPath)
+	var fileErr *LegacyFileError
+	if !errors.As(err, &fileErr) {
+		t.Fatalf("Expected LegacyFileError, got %v", err)
+	}
+	if len(fileErr.Lines) != 3 || fileErr.Lines[0].Line != 2 || fileErr.Lines[1].Line != 3 || fileErr.Lines[2].Line != 4 {
+		t.Fatalf("Expected lines 2, 3 and 4 to be reported, got %+v", fileErr.Lines)
+	}
+	check(store)
+
+
+	os.Remove(legacyPath)
+	if changes, err := store.ReloadLegacy(legacyPath); err != nil || !changes.Empty() {
+		t.Fatalf("Expected a missing file to change nothing, got %s, %v", changes.String(), err)
+	}
+	check(store)
+}
@@ -0,0 +1,155 @@
+package userdb
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LineError is a malformed line of the legacy token file.
+type LineError struct {
+	Line int
+	Err  string
+}
+
+// LegacyFileError lists every malformed line of a legacy token file. A file
+// with any of them is not applied.
+type LegacyFileError struct {
+	Path  string
+	Lines []LineError
+}
+
+func (e *LegacyFileError) Error() string {
+	parts := make([]string, 0, len(e.Lines))
+	for _, line := range e.Lines {
+		parts = append(parts, fmt.Sprintf("%s:%d: %s", e.Path, line.Line, line.Err))
+	}
+	return fmt.Sprintf("%d malformed lines in %s: %s", len(e.Lines), e.Path, strings.Join(parts, "; "))
+}
+
+// readLegacyTokens parses the LogPas.txt format: one "<token> <userID>" pair
+// per line, optionally followed by the tenant and the role. Blank lines and
+// lines starting with # are ignored.
+func readLegacyTokens(filename string) ([]TokenRecord, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open token file: %w", err)
+	}
+	defer file.Close()
+
+	var records []TokenRecord
+	var malformed []LineError
+	seen := make(map[string]int)
+	now := time.Now()
+
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.Fields(line)
+		if len(parts) < 2 || len(parts) > 4 {
+			malformed = append(malformed, LineError{lineNo, fmt.Sprintf("expected \"<token> <user ID> [tenant] [role]\", got %d fields", len(parts))})
+			continue
+		}
+
+		userID, err := strconv.Atoi(parts[1])
+		if err != nil || userID <= 0 {
+			malformed = append(malformed, LineError{lineNo, fmt.Sprintf("invalid user ID %q", parts[1])})
+			continue
+		}
+
+		if first, exists := seen[parts[0]]; exists {
+			malformed = append(malformed, LineError{lineNo, fmt.Sprintf("token already listed on line %d", first)})
+			continue
+		}
+		seen[parts[0]] = lineNo
+
+		record := TokenRecord{Token: parts[0], UserID: userID, CreatedAt: now}
+		if len(parts) >= 3 {
+			record.Tenant = parts[2]
+		}
+		if len(parts) == 4 {
+			record.Role = parts[3]
+		}
+		records = append(records, record)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read token file: %w", err)
+	}
+	if len(malformed) > 0 {
+		return nil, &LegacyFileError{Path: filename, Lines: malformed}
+	}
+	return records, nil
+}
+
+// IsLegacy tells tokens from the legacy file apart from issued ones: access
+// tokens always expire and refresh tokens have a kind.
+func (r *TokenRecord) IsLegacy() bool {
+	return r.Kind == "" && r.ExpiresAt.IsZero()
+}
+
+// LegacyChanges is what a reload of the legacy file changes in the store.
+type LegacyChanges struct {
+	Added   []TokenRecord
+	Updated []TokenRecord
+	Removed []TokenRecord
+}
+
+func (c *LegacyChanges) Empty() bool {
+	return len(c.Added) == 0 && len(c.Updated) == 0 && len(c.Removed) == 0
+}
+
+func (c *LegacyChanges) String() string {
+	return fmt.Sprintf("%d added, %d updated, %d removed", len(c.Added), len(c.Updated), len(c.Removed))
+}
+
+func (c *LegacyChanges) records() []TokenRecord {
+	records := make([]TokenRecord, 0, len(c.Added)+len(c.Updated)+len(c.Removed))
+	records = append(records, c.Added...)
+	records = append(records, c.Updated...)
+	return append(records, c.Removed...)
+}
+
+// legacyChanges compares the legacy tokens in current with the ones read
+// from the file. Tokens still listed keep their creation time and their
+// revocation; tokens no longer listed come back as Removed tombstones.
+func legacyChanges(current map[string]TokenRecord, listed []TokenRecord) LegacyChanges {
+	var changes LegacyChanges
+	inFile := make(map[string]bool, len(listed))
+
+	for _, record := range listed {
+		inFile[record.Token] = true
+
+		existing, exists := current[record.Token]
+		switch {
+		case !exists:
+			changes.Added = append(changes.Added, record)
+		case !existing.IsLegacy():
+			// The same string as an issued token's jti or refresh hash;
+			// never let the file overwrite it.
+			continue
+		case existing.UserID != record.UserID || existing.Tenant != record.Tenant || existing.Role != record.Role:
+			record.CreatedAt = existing.CreatedAt
+			record.Revoked = existing.Revoked
+			changes.Updated = append(changes.Updated, record)
+		}
+	}
+
+	for token, record := range current {
+		if record.IsLegacy() && !inFile[token] {
+			record.Removed = true
+			changes.Removed = append(changes.Removed, record)
+		}
+	}
+
+	return changes
+}
@@ -0,0 +1,21 @@
+package userdb
+
+import (
+	"golang.org/x/crypto/bcrypt"
+)
+
+// dummyHash is compared against when an account does not exist, so that a
+// failed login takes the same time whether or not the email is known.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
@@ -1,71 +1,250 @@
 package userdb
 
 import (
-	"bufio"
-	"fmt"
-	"os"
-	"strconv"
-	"strings"
+	"errors"
 	"sync"
+	"time"
 )
 
-type TokenStore struct {
-	tokens map[string]int
+// DefaultTenant owns the shared stock and sales dumps.
+const DefaultTenant = "default"
+
+// Roles stored on users and tokens. What each role may do is decided by the
+// auth package.
+const (
+	RoleViewer  = "viewer"
+	RoleAnalyst = "analyst"
+	RoleAdmin   = "admin"
+)
+
+// KindRefresh marks refresh token records. Access tokens have no kind.
+const KindRefresh = "refresh"
+
+var (
+	ErrTokenNotFound = errors.New("token not found")
+	ErrTokenReused   = errors.New("token already used")
+)
+
+// TokenRecord is one entry of the token allow list. Token holds an opaque
+// legacy token, the jti of an issued JWT or the hash of a refresh token.
+// Tokens issued from one login share a Family. ExpiresAt marks when the
+// record can be dropped; the JWT's own exp claim is what rejects a token, so
+// lookups only honour Revoked. A zero ExpiresAt is kept forever. Removed only
+// appears in the token journal, where it deletes the token on replay.
+type TokenRecord struct {
+	Token     string    `json:"token"`
+	UserID    int       `json:"user_id"`
+	Tenant    string    `json:"tenant,omitempty"`
+	Role      string    `json:"role,omitempty"`
+	Kind      string    `json:"kind,omitempty"`
+	Family    string    `json:"family,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+	Revoked   bool      `json:"revoked,omitempty"`
+	Removed   bool      `json:"removed,omitempty"`
+}
+
+func (r *TokenRecord) expired(now time.Time) bool {
+	return !r.ExpiresAt.IsZero() && !now.Before(r.ExpiresAt)
+}
+
+// TokenStore is the allow list consulted on every token validation.
+type TokenStore interface {
+	SaveToken(record TokenRecord) error
+	ValidateToken(token string) (int, bool)
+	LookupToken(token string) (TokenRecord, bool)
+	RevokeToken(token string) error
+	RevokeUserTokens(userID int) (int, error)
+	RevokeFamily(family string) (int, error)
+	ConsumeToken(token string) (TokenRecord, error)
+	GetTokenCount() int
+	MaxUserID() int
+	Close() error
+}
+
+// MemoryTokenStore keeps tokens in a map and loses them on restart. It backs
+// the file store and is used directly in tests.
+type MemoryTokenStore struct {
+	tokens map[string]TokenRecord
 	mu     sync.RWMutex
 }
 
-func NewTokenStore() *TokenStore {
-	return &TokenStore{
-		tokens: make(map[string]int),
+func NewTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{
+		tokens: make(map[string]TokenRecord),
 	}
 }
 
-func (ts *TokenStore) LoadFromFile(filename string) error {
-	file, err := os.Open(filename)
+// LoadFromFile makes the legacy tokens in the store match filename: tokens
+// added to the file become valid, removed ones stop being valid, and
+// revocations of tokens still listed are kept. A file with malformed lines
+// is rejected as a whole and leaves the store unchanged.
+func (ts *MemoryTokenStore) LoadFromFile(filename string) error {
+	records, err := readLegacyTokens(filename)
 	if err != nil {
-		return fmt.Errorf("failed to open token file: %w", err)
+		return err
 	}
-	defer file.Close()
 
 	ts.mu.Lock()
 	defer ts.mu.Unlock()
+	changes := legacyChanges(ts.tokens, records)
+	ts.applyLocked(changes.records())
+	return nil
+}
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" {
-			continue
-		}
+func (ts *MemoryTokenStore) AddToken(token string, userID int) {
+	ts.SaveToken(TokenRecord{Token: token, UserID: userID, CreatedAt: time.Now()})
+}
 
-		parts := strings.Fields(line)
-		if len(parts) >= 2 {
-			token := parts[0]
-			userID, err := strconv.Atoi(parts[1])
-			if err == nil {
-				ts.tokens[token] = userID
-			}
-		}
+func (ts *MemoryTokenStore) SaveToken(record TokenRecord) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.tokens[record.Token] = record
+	return nil
+}
+
+func (ts *MemoryTokenStore) RemoveToken(token string) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	delete(ts.tokens, token)
+}
+
+func (ts *MemoryTokenStore) RevokeToken(token string) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if record, exists := ts.tokens[token]; exists {
+		record.Revoked = true
+		ts.tokens[token] = record
 	}
+	return nil
+}
 
-	return scanner.Err()
+// RevokeUserTokens revokes every active token of userID and returns how many
+// were revoked.
+func (ts *MemoryTokenStore) RevokeUserTokens(userID int) (int, error) {
+	return ts.revokeWhere(func(record TokenRecord) bool { return record.UserID == userID })
+}
+
+// RevokeFamily revokes every active token issued from the same login.
+func (ts *MemoryTokenStore) RevokeFamily(family string) (int, error) {
+	if family == "" {
+		return 0, nil
+	}
+	return ts.revokeWhere(func(record TokenRecord) bool { return record.Family == family })
 }
 
-func (ts *TokenStore) AddToken(token string, userID int) {
+func (ts *MemoryTokenStore) revokeWhere(match func(TokenRecord) bool) (int, error) {
 	ts.mu.Lock()
 	defer ts.mu.Unlock()
-	ts.tokens[token] = userID
+
+	revoked := 0
+	for token, record := range ts.tokens {
+		if match(record) && !record.Revoked {
+			record.Revoked = true
+			ts.tokens[token] = record
+			revoked++
+		}
+	}
+	return revoked, nil
 }
 
-func (ts *TokenStore) ValidateToken(token string) (int, bool) {
+// ConsumeToken revokes a single-use token and returns its record. Of several
+// concurrent calls only one succeeds; the others, and any later call, get the
+// record back together with ErrTokenReused.
+func (ts *MemoryTokenStore) ConsumeToken(token string) (TokenRecord, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	record, exists := ts.tokens[token]
+	if !exists {
+		return TokenRecord{}, ErrTokenNotFound
+	}
+	if record.Revoked {
+		return record, ErrTokenReused
+	}
+
+	consumed := record
+	consumed.Revoked = true
+	ts.tokens[token] = consumed
+	return record, nil
+}
+
+func (ts *MemoryTokenStore) ValidateToken(token string) (int, bool) {
+	record, exists := ts.LookupToken(token)
+	return record.UserID, exists
+}
+
+// LookupToken returns the record of an allowed, unrevoked token.
+func (ts *MemoryTokenStore) LookupToken(token string) (TokenRecord, bool) {
+	record, exists := ts.find(token)
+	if !exists || record.Revoked {
+		return TokenRecord{}, false
+	}
+	return record, true
+}
+
+// GetTokenCount returns the number of tokens that are neither revoked nor
+// expired.
+func (ts *MemoryTokenStore) GetTokenCount() int {
 	ts.mu.RLock()
 	defer ts.mu.RUnlock()
-	
-	userID, exists := ts.tokens[token]
-	return userID, exists
+
+	now := time.Now()
+	count := 0
+	for _, record := range ts.tokens {
+		if !record.Revoked && !record.expired(now) {
+			count++
+		}
+	}
+	return count
 }
 
-func (ts *TokenStore) GetTokenCount() int {
+// MaxUserID returns the highest user ID any token was issued to, revoked or
+// not, so that new accounts never take over the ID of an existing client.
+func (ts *MemoryTokenStore) MaxUserID() int {
 	ts.mu.RLock()
 	defer ts.mu.RUnlock()
-	return len(ts.tokens)
+
+	maxID := 0
+	for _, record := range ts.tokens {
+		if record.UserID > maxID {
+			maxID = record.UserID
+		}
+	}
+	return maxID
+}
+
+// applyLocked saves records, deleting the removed ones. The caller must
+// hold the write lock.
+func (ts *MemoryTokenStore) applyLocked(records []TokenRecord) {
+	for _, record := range records {
+		if record.Removed {
+			delete(ts.tokens, record.Token)
+			continue
+		}
+		ts.tokens[record.Token] = record
+	}
+}
+
+func (ts *MemoryTokenStore) find(token string) (TokenRecord, bool) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	record, exists := ts.tokens[token]
+	return record, exists
+}
+
+func (ts *MemoryTokenStore) snapshot() []TokenRecord {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	records := make([]TokenRecord, 0, len(ts.tokens))
+	for _, record := range ts.tokens {
+		records = append(records, record)
+	}
+	return records
+}
+
+func (ts *MemoryTokenStore) Close() error {
+	return nil
 }
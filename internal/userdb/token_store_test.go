@@ -1,7 +1,10 @@
 package userdb
 
 import (
+	"errors"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -30,9 +33,43 @@ func TestTokenStore_AddAndValidateToken(t *testing.T) {
 	}
 }
 
+func TestTokenStore_RemoveToken(t *testing.T) {
+	store := NewTokenStore()
+	store.AddToken("token1", 1)
+
+
+	store.RemoveToken("token1")
+	store.RemoveToken("non-existent")
+
+
+	if _, exists := store.ValidateToken("token1"); exists {
+		t.Fatal("Expected removed token to not exist")
+	}
+}
+
+func TestTokenStore_RevokeToken(t *testing.T) {
+	store := NewTokenStore()
+	store.AddToken("token1", 1)
+	store.AddToken("token2", 1)
+
+
+	if err := store.RevokeToken("token1"); err != nil {
+		t.Fatalf("Failed to revoke: %v", err)
+	}
+
+
+	if _, exists := store.ValidateToken("token1"); exists {
+		t.Fatal("Expected revoked token to be rejected")
+	}
+
+	if count := store.GetTokenCount(); count != 1 {
+		t.Fatalf("Expected 1 active token, got %d", count)
+	}
+}
+
 func TestTokenStore_LoadFromFile(t *testing.T) {
 
-	content := "token1 1\ntoken2 2\ntoken3 3"
+	content := "token1 1\ntoken2 2\ntoken3 3 client-b"
 	tmpFile, err := os.CreateTemp("", "test-tokens")
 	if err != nil {
 		t.Fatalf("Failed to create temp file: %v", err)
@@ -72,6 +109,15 @@ func TestTokenStore_LoadFromFile(t *testing.T) {
 			t.Fatalf("Token %s: expected user ID %d, got %d", tc.token, tc.userID, userID)
 		}
 	}
+
+
+	if record, _ := store.LookupToken("token1"); record.Tenant != "" {
+		t.Fatalf("Expected token1 without a tenant, got %q", record.Tenant)
+	}
+
+	if record, _ := store.LookupToken("token3"); record.Tenant != "client-b" {
+		t.Fatalf("Expected token3 in client-b, got %q", record.Tenant)
+	}
 }
 
 func TestTokenStore_GetTokenCount(t *testing.T) {
@@ -91,3 +137,50 @@ func TestTokenStore_GetTokenCount(t *testing.T) {
 		t.Fatalf("Expected 2 tokens, got %d", count)
 	}
 }
+
+func TestTokenStore_ConsumeToken(t *testing.T) {
+	store := NewTokenStore()
+	store.SaveToken(TokenRecord{Token: "refresh-1", UserID: 1, Kind: KindRefresh, Family: "f1"})
+
+	if _, err := store.ConsumeToken("refresh-1"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if _, exists := store.LookupToken("refresh-1"); exists {
+		t.Fatal("Expected consumed token to be revoked")
+	}
+
+	if record, err := store.ConsumeToken("refresh-1"); !errors.Is(err, ErrTokenReused) || record.Family != "f1" {
+		t.Fatalf("Expected ErrTokenReused with the record, got %+v, %v", record, err)
+	}
+}
+
+func TestTokenStore_LoadFromFile_Removals(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "LogPas.txt")
+	store := NewTokenStore()
+
+
+	os.WriteFile(path, []byte("token1 1\ntoken2 2\n"), 0o600)
+	if err := store.LoadFromFile(path); err != nil {
+		t.Fatalf("Failed to load tokens: %v", err)
+	}
+	
+	os.WriteFile(path, []byte("token2 2\n"), 0o600)
+	if err := store.LoadFromFile(path); err != nil {
+		t.Fatalf("Failed to reload tokens: %v", err)
+	}
+	
+	if _, exists := store.ValidateToken("token1"); exists {
+		t.Fatal("Expected removed token to be rejected after reload")
+	}
+	
+
+	os.WriteFile(path, []byte("token3\n"), 0o600)
+	if err := store.LoadFromFile(path); err == nil || !strings.Contains(err.Error(), ":1:") {
+		t.Fatalf("Expected the malformed line to be reported, got %v", err)
+	}
+	
+	if _, exists := store.ValidateToken("token2"); !exists {
+		t.Fatal("Expected a malformed file to leave the store unchanged")
+	}
+}
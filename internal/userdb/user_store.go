@@ -0,0 +1,302 @@
+package userdb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	minPasswordLength = 8
+
+	// maxPasswordLength is bcrypt's limit, in bytes.
+	maxPasswordLength = 72
+)
+
+var (
+	ErrUserExists         = errors.New("user already exists")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrInvalidEmail       = errors.New("invalid email address")
+	ErrWeakPassword       = fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	ErrLongPassword       = fmt.Errorf("password must be at most %d bytes", maxPasswordLength)
+)
+
+type User struct {
+	ID           int    `json:"id"`
+	Email        string `json:"email"`
+	PasswordHash string `json:"password_hash"`
+	Tenant       string `json:"tenant,omitempty"`
+	Role         string `json:"role,omitempty"`
+	Disabled     bool   `json:"disabled,omitempty"`
+}
+
+// UserStore keeps accounts keyed by normalized email. Passwords are only ever
+// held as bcrypt hashes. Stores opened from a file write every change back.
+type UserStore struct {
+	users map[string]*User
+	path  string
+	mu    sync.RWMutex
+}
+
+func NewUserStore() *UserStore {
+	return &UserStore{
+		users: make(map[string]*User),
+	}
+}
+
+// OpenUserStore loads users from path if it exists and persists later
+// changes there.
+func OpenUserStore(path string) (*UserStore, error) {
+	us := NewUserStore()
+	us.path = path
+
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return us, nil
+	}
+
+	if err := us.LoadFromFile(path); err != nil {
+		return nil, err
+	}
+	return us, nil
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// LoadFromFile reads a JSON array of users with pre-hashed passwords.
+func (us *UserStore) LoadFromFile(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open user file: %w", err)
+	}
+
+	var users []User
+	if err := json.Unmarshal(data, &users); err != nil {
+		return fmt.Errorf("failed to parse user file: %w", err)
+	}
+
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	for i := range users {
+		user := users[i]
+		if user.Email == "" || user.PasswordHash == "" {
+			return fmt.Errorf("user %d: email and password_hash are required", i)
+		}
+		if _, err := bcrypt.Cost([]byte(user.PasswordHash)); err != nil {
+			return fmt.Errorf("user %s: password_hash is not a bcrypt hash", user.Email)
+		}
+		us.users[normalizeEmail(user.Email)] = &user
+	}
+
+	return nil
+}
+
+func (us *UserStore) AddUser(id int, email, password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	us.users[normalizeEmail(email)] = &User{ID: id, Email: email, PasswordHash: hash}
+	return nil
+}
+
+// VerifyCredentials returns the account matching email and password. Unknown
+// emails, wrong passwords and disabled accounts are indistinguishable.
+func (us *UserStore) VerifyCredentials(email, password string) (*User, bool) {
+	us.mu.RLock()
+	user, exists := us.users[normalizeEmail(email)]
+	us.mu.RUnlock()
+
+	if !exists {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, false
+	}
+
+	if !CheckPassword(user.PasswordHash, password) || user.Disabled {
+		return nil, false
+	}
+
+	found := *user
+	return &found, true
+}
+
+// GetUser returns a copy of the account with the given ID.
+func (us *UserStore) GetUser(id int) (*User, bool) {
+	us.mu.RLock()
+	defer us.mu.RUnlock()
+
+	for _, user := range us.users {
+		if user.ID == id {
+			found := *user
+			return &found, true
+		}
+	}
+	return nil, false
+}
+
+// GetUserByEmail returns a copy of the account registered under email.
+func (us *UserStore) GetUserByEmail(email string) (*User, bool) {
+	us.mu.RLock()
+	defer us.mu.RUnlock()
+
+	user, exists := us.users[normalizeEmail(email)]
+	if !exists {
+		return nil, false
+	}
+	found := *user
+	return &found, true
+}
+
+func checkPasswordLength(password string) error {
+	if len(password) < minPasswordLength {
+		return ErrWeakPassword
+	}
+	if len(password) > maxPasswordLength {
+		return ErrLongPassword
+	}
+	return nil
+}
+
+// Register creates a viewer account with the next free ID above both the
+// accounts in the store and takenID, the highest ID already used outside it.
+func (us *UserStore) Register(email, password string, takenID int) (*User, error) {
+	addr, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil || addr.Address != strings.TrimSpace(email) {
+		return nil, ErrInvalidEmail
+	}
+	if err := checkPasswordLength(password); err != nil {
+		return nil, err
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	key := normalizeEmail(email)
+	if _, exists := us.users[key]; exists {
+		return nil, ErrUserExists
+	}
+
+	nextID := takenID + 1
+	for _, user := range us.users {
+		if user.ID >= nextID {
+			nextID = user.ID + 1
+		}
+	}
+
+	user := &User{ID: nextID, Email: addr.Address, PasswordHash: hash, Role: RoleViewer}
+	us.users[key] = user
+	if err := us.save(); err != nil {
+		delete(us.users, key)
+		return nil, err
+	}
+
+	registered := *user
+	return &registered, nil
+}
+
+func (us *UserStore) ChangePassword(email, oldPassword, newPassword string) error {
+	if err := checkPasswordLength(newPassword); err != nil {
+		return err
+	}
+
+	if _, ok := us.VerifyCredentials(email, oldPassword); !ok {
+		return ErrInvalidCredentials
+	}
+
+	hash, err := HashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	return us.update(email, func(user *User) { user.PasswordHash = hash })
+}
+
+func (us *UserStore) Disable(email string) error {
+	return us.update(email, func(user *User) { user.Disabled = true })
+}
+
+// update applies change to a copy of the user and only swaps it in once the
+// file has been written.
+func (us *UserStore) update(email string, change func(*User)) error {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	key := normalizeEmail(email)
+	current, exists := us.users[key]
+	if !exists {
+		return ErrUserNotFound
+	}
+
+	updated := *current
+	change(&updated)
+
+	us.users[key] = &updated
+	if err := us.save(); err != nil {
+		us.users[key] = current
+		return err
+	}
+	return nil
+}
+
+// save writes all users to the backing file via a temp file and rename. The
+// caller must hold the write lock.
+func (us *UserStore) save() error {
+	if us.path == "" {
+		return nil
+	}
+
+	users := make([]User, 0, len(us.users))
+	for _, user := range us.users {
+		users = append(users, *user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	data, err := json.MarshalIndent(users, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode users: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(us.path), ".users-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to save users: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save users: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save users: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), us.path); err != nil {
+		return fmt.Errorf("failed to save users: %w", err)
+	}
+	return nil
+}
+
+func (us *UserStore) GetUserCount() int {
+	us.mu.RLock()
+	defer us.mu.RUnlock()
+	return len(us.users)
+}
@@ -0,0 +1,189 @@
+package userdb
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUserStore_VerifyCredentials(t *testing.T) {
+	store := NewUserStore()
+	if err := store.AddUser(1, "Test@Example.com", "password123"); err != nil {
+		t.Fatalf("Failed to add user: %v", err)
+	}
+
+
+	user, ok := store.VerifyCredentials("test@example.com ", "password123")
+	if !ok {
+		t.Fatal("Expected credentials to verify")
+	}
+
+	if user.ID != 1 || strings.Contains(user.PasswordHash, "password123") {
+		t.Fatalf("Unexpected user: %+v", user)
+	}
+
+
+	if _, ok := store.VerifyCredentials("test@example.com", "wrong"); ok {
+		t.Fatal("Expected wrong password to fail")
+	}
+
+	if _, ok := store.VerifyCredentials("nobody@example.com", "password123"); ok {
+		t.Fatal("Expected unknown email to fail")
+	}
+}
+
+func TestUserStore_LoadFromFile(t *testing.T) {
+	hash, err := HashPassword("password123")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+
+	users := []User{
+		{ID: 1, Email: "active@example.com", PasswordHash: hash},
+		{ID: 2, Email: "disabled@example.com", PasswordHash: hash, Disabled: true},
+	}
+	data, _ := json.Marshal(users)
+
+	path := filepath.Join(t.TempDir(), "users.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("Failed to write users file: %v", err)
+	}
+
+
+	store := NewUserStore()
+	if err := store.LoadFromFile(path); err != nil {
+		t.Fatalf("Failed to load users: %v", err)
+	}
+
+	if count := store.GetUserCount(); count != 2 {
+		t.Fatalf("Expected 2 users, got %d", count)
+	}
+
+	if _, ok := store.VerifyCredentials("active@example.com", "password123"); !ok {
+		t.Fatal("Expected active user to verify")
+	}
+
+	if _, ok := store.VerifyCredentials("disabled@example.com", "password123"); ok {
+		t.Fatal("Expected disabled user to fail")
+	}
+}
+
+func TestUserStore_LoadFromFile_PlaintextPassword(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	if err := os.WriteFile(path, []byte(`[{"id": 1, "email": "a@example.com", "password_hash": "password123"}]`), 0o600); err != nil {
+		t.Fatalf("Failed to write users file: %v", err)
+	}
+
+
+	if err := NewUserStore().LoadFromFile(path); err == nil {
+		t.Fatal("Expected plaintext password to be rejected")
+	}
+}
+
+func TestUserStore_Register(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	store, err := OpenUserStore(path)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+
+	first, err := store.Register("first@example.com", "password123", 0)
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+
+	second, err := store.Register("second@example.com", "password456", 0)
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+
+	if first.ID != 1 || second.ID != 2 {
+		t.Fatalf("Expected sequential IDs, got %d and %d", first.ID, second.ID)
+	}
+
+	third, err := store.Register("third@example.com", "password789", 7)
+	if err != nil || third.ID != 8 {
+		t.Fatalf("Expected an ID above the taken ones, got %+v, %v", third, err)
+	}
+
+
+	testCases := []struct {
+		email    string
+		password string
+		err      error
+	}{
+		{"FIRST@example.com", "password123", ErrUserExists},
+		{"not-an-email", "password123", ErrInvalidEmail},
+		{"Name <third@example.com>", "password123", ErrInvalidEmail},
+		{"third@example.com", "short", ErrWeakPassword},
+		{"third@example.com", strings.Repeat("p", 73), ErrLongPassword},
+	}
+
+	for _, tc := range testCases {
+		if _, err := store.Register(tc.email, tc.password, 0); !errors.Is(err, tc.err) {
+			t.Fatalf("Register(%q): expected %v, got %v", tc.email, tc.err, err)
+		}
+	}
+
+
+	reopened, err := OpenUserStore(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+
+	if _, ok := reopened.VerifyCredentials("second@example.com", "password456"); !ok {
+		t.Fatal("Expected registered user to survive a reopen")
+	}
+}
+
+func TestUserStore_ChangePasswordAndDisable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	store, err := OpenUserStore(path)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	if _, err := store.Register("user@example.com", "password123", 0); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+
+
+	if err := store.ChangePassword("user@example.com", "password123", strings.Repeat("p", 80)); !errors.Is(err, ErrLongPassword) {
+		t.Fatalf("Expected ErrLongPassword, got %v", err)
+	}
+
+	if err := store.ChangePassword("user@example.com", "wrong-password", "new-password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Expected ErrInvalidCredentials, got %v", err)
+	}
+
+	if err := store.ChangePassword("user@example.com", "password123", "new-password"); err != nil {
+		t.Fatalf("Failed to change password: %v", err)
+	}
+
+	if _, ok := store.VerifyCredentials("user@example.com", "password123"); ok {
+		t.Fatal("Expected old password to stop working")
+	}
+
+
+	if err := store.Disable("nobody@example.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("Expected ErrUserNotFound, got %v", err)
+	}
+
+	if err := store.Disable("user@example.com"); err != nil {
+		t.Fatalf("Failed to disable: %v", err)
+	}
+
+
+	reopened, err := OpenUserStore(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+
+	if _, ok := reopened.VerifyCredentials("user@example.com", "new-password"); ok {
+		t.Fatal("Expected disabled user to fail after reopen")
+	}
+}
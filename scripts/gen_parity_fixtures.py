@@ -0,0 +1,72 @@
+"""Regenerate expected results for the Go parity tests.
+
+Runs _prepare_data from routes/GetItemAnalytics.py on the stock and sales rows
+of every internal/analytics/testdata/parity/*.json fixture and stores its
+output under "expected". FastAPI, pydantic and requests are stubbed so the
+script works without the Python service dependencies installed.
+
+Usage: python3 scripts/gen_parity_fixtures.py
+"""
+import glob
+import importlib.util
+import json
+import os
+import sys
+import types
+from datetime import datetime, timedelta
+
+ROOT = os.path.dirname(os.path.dirname(os.path.abspath(__file__)))
+FIXTURES = os.path.join(ROOT, "internal", "analytics", "testdata", "parity", "*.json")
+
+
+def _stub_modules():
+    fastapi = types.ModuleType("fastapi")
+
+    class APIRouter:
+        def __init__(self, *args, **kwargs):
+            pass
+
+        def post(self, *args, **kwargs):
+            return lambda func: func
+
+    fastapi.APIRouter = APIRouter
+
+    pydantic = types.ModuleType("pydantic")
+
+    class BaseModel:
+        pass
+
+    pydantic.BaseModel = BaseModel
+
+    sys.modules.setdefault("fastapi", fastapi)
+    sys.modules.setdefault("pydantic", pydantic)
+    sys.modules.setdefault("requests", types.ModuleType("requests"))
+
+
+def _load_router():
+    _stub_modules()
+    path = os.path.join(ROOT, "routes", "GetItemAnalytics.py")
+    spec = importlib.util.spec_from_file_location("GetItemAnalytics", path)
+    module = importlib.util.module_from_spec(spec)
+    spec.loader.exec_module(module)
+    return module
+
+
+def main():
+    router = _load_router()
+    for path in sorted(glob.glob(FIXTURES)):
+        with open(path, "r", encoding="utf-8") as f:
+            fixture = json.load(f)
+
+        start_dt = datetime.strptime(fixture["StartDate"], "%d.%m.%Y")
+        end_dt = datetime.strptime(fixture["FinishDate"], "%d.%m.%Y") + timedelta(days=1)
+        fixture["expected"] = router._prepare_data(fixture["stock"], fixture["sales"], start_dt, end_dt)
+
+        with open(path, "w", encoding="utf-8") as f:
+            json.dump(fixture, f, ensure_ascii=False, indent=2)
+            f.write("\n")
+        print(f"{os.path.relpath(path, ROOT)}: {len(fixture['expected'])} items")
+
+
+if __name__ == "__main__":
+    main()
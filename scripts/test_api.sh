@@ -46,15 +46,15 @@ fi
 
 # Test 3: Validate token
 echo -e "\n${YELLOW}3. Validating token...${NC}"
-curl -s "$BASE_URL/validate?token=$TOKEN" | jq .
+curl -s "$BASE_URL/validate" -H "Authorization: Bearer $TOKEN" | jq .
 print_status $? "Token validation"
 
 # Test 4: Analytics with generated token
 echo -e "\n${YELLOW}4. Testing analytics endpoint...${NC}"
 ANALYTICS_RESPONSE=$(curl -s -X POST "$BASE_URL/analytics" \
     -H "Content-Type: application/json" \
+    -H "Authorization: Bearer $TOKEN" \
     -d "{
-        \"token\": \"$TOKEN\",
         \"StartDate\": \"01.01.2024\",
         \"FinishDate\": \"31.01.2024\"
     }")
@@ -79,8 +79,8 @@ fi
 echo -e "\n${YELLOW}5. Testing analytics with invalid token...${NC}"
 curl -s -X POST "$BASE_URL/analytics" \
     -H "Content-Type: application/json" \
+    -H "Authorization: Bearer invalid-token" \
     -d '{
-        "token": "invalid-token",
         "StartDate": "01.01.2024",
         "FinishDate": "31.01.2024"
     }' | jq .